@@ -0,0 +1,389 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSenderClosed is returned when queueing a message on, or
+// flushing, an AsyncSender which has been closed
+var ErrSenderClosed = errors.New("Sender is closed")
+
+const (
+	defaultFlushCount       = 100
+	defaultFlushConcurrency = 4
+	defaultFlushInterval    = time.Second
+	defaultQueueSize        = 1000
+)
+
+// SendResult is the future outcome of a message queued on an AsyncSender
+type SendResult struct {
+	Message *Message
+
+	done chan struct{}
+	err  error
+}
+
+// Done is closed once the message has been sent or has failed
+func (r *SendResult) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns the error of the send, and is valid once Done is closed
+func (r *SendResult) Err() error {
+	return r.err
+}
+
+// Wait blocks until the message has been sent or the context is done
+func (r *SendResult) Wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *SendResult) complete(err error) {
+	r.err = err
+	close(r.done)
+}
+
+// AsyncSenderOption configures an AsyncSender
+type AsyncSenderOption func(*AsyncSender)
+
+// WithFlushCount flushes queued messages once the specified
+// number of messages are waiting
+func WithFlushCount(count int) AsyncSenderOption {
+	return func(a *AsyncSender) {
+		a.flushCount = count
+	}
+}
+
+// WithFlushSize flushes queued messages once their combined
+// size in bytes reaches the specified size
+func WithFlushSize(size int) AsyncSenderOption {
+	return func(a *AsyncSender) {
+		a.flushSize = size
+	}
+}
+
+// WithFlushInterval flushes queued messages at least this often
+func WithFlushInterval(interval time.Duration) AsyncSenderOption {
+	return func(a *AsyncSender) {
+		a.flushInterval = interval
+	}
+}
+
+// WithQueueSize sets how many messages can be waiting to be
+// picked up by the background flusher before Send blocks
+func WithQueueSize(size int) AsyncSenderOption {
+	return func(a *AsyncSender) {
+		a.queueSize = size
+	}
+}
+
+// WithFlushConcurrency sets how many flushed batches are sent at
+// the same time; once they are all in flight, flushing waits
+func WithFlushConcurrency(concurrency int) AsyncSenderOption {
+	return func(a *AsyncSender) {
+		a.flushConcurrency = concurrency
+	}
+}
+
+// WithResultCallback sets a function called with the outcome of
+// every message, from the background flusher; batches are sent
+// concurrently, so it may be called concurrently too
+func WithResultCallback(callback func(message *Message, err error)) AsyncSenderOption {
+	return func(a *AsyncSender) {
+		a.callback = callback
+	}
+}
+
+// AsyncSender queues messages in memory and sends them in batches from
+// the background, flushing by count, size and interval. Messages which
+// cannot be sent in a batch, such as compressed or encrypted ones, are
+// sent one by one. It is safe for concurrent use.
+type AsyncSender struct {
+	sender           Sender
+	flushCount       int
+	flushSize        int
+	flushInterval    time.Duration
+	flushConcurrency int
+	queueSize        int
+	callback         func(message *Message, err error)
+
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+	closing   chan struct{}
+	queue     chan *SendResult
+	flushes   chan flushRequest
+	quit      chan struct{}
+	done      chan struct{}
+
+	// ctx bounds background flushes, and is cancelled
+	// when Close gives up waiting for them
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	pending     []*SendResult
+	pendingSize int
+	slots       chan struct{}
+	inflight    []chan struct{}
+}
+
+// flushRequest asks the background flusher to send all queued
+// messages with the context of the call to Flush
+type flushRequest struct {
+	ctx     context.Context
+	flushed chan struct{}
+}
+
+// NewAsyncSender creates an AsyncSender on top of a Sender and
+// starts its background flusher
+func NewAsyncSender(sender Sender, opts ...AsyncSenderOption) *AsyncSender {
+	a := &AsyncSender{
+		sender:           sender,
+		flushCount:       defaultFlushCount,
+		flushSize:        defaultMaxMessageSize,
+		flushInterval:    defaultFlushInterval,
+		flushConcurrency: defaultFlushConcurrency,
+		queueSize:        defaultQueueSize,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.queue = make(chan *SendResult, a.queueSize)
+	a.slots = make(chan struct{}, a.flushConcurrency)
+	a.flushes = make(chan flushRequest)
+	a.closing = make(chan struct{})
+	a.quit = make(chan struct{})
+	a.done = make(chan struct{})
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+
+	go a.run()
+	return a
+}
+
+// Send queues a message to be sent in the background
+func (a *AsyncSender) Send(message *Message) (*SendResult, error) {
+	return a.SendContext(context.Background(), message)
+}
+
+// SendContext queues a message to be sent in the background, waiting
+// for room in the queue until the context is done
+func (a *AsyncSender) SendContext(ctx context.Context, message *Message) (*SendResult, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return nil, ErrSenderClosed
+	}
+
+	result := &SendResult{Message: message, done: make(chan struct{})}
+	select {
+	case a.queue <- result:
+		return result, nil
+	case <-a.closing:
+		return nil, ErrSenderClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Flush sends all queued messages, waiting until they have been sent
+// or the context is done, which cancels the sends still in flight
+func (a *AsyncSender) Flush(ctx context.Context) error {
+	request := flushRequest{ctx: ctx, flushed: make(chan struct{})}
+	select {
+	case a.flushes <- request:
+	case <-a.done:
+		return ErrSenderClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-request.flushed:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages and sends all queued messages,
+// waiting until they have been sent or the context is done, which
+// cancels the sends still in flight
+func (a *AsyncSender) Close(ctx context.Context) error {
+	a.closeOnce.Do(func() {
+		// Wake up senders waiting for room in the queue, so
+		// no message can be queued once the flusher has quit
+		close(a.closing)
+
+		a.mu.Lock()
+		a.closed = true
+		a.mu.Unlock()
+
+		close(a.quit)
+	})
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		a.cancel()
+		return ctx.Err()
+	}
+}
+
+func (a *AsyncSender) run() {
+	defer close(a.done)
+	defer a.cancel()
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case result := <-a.queue:
+			a.add(result)
+		case <-ticker.C:
+			a.flush(a.ctx)
+		case request := <-a.flushes:
+			a.drain()
+			a.flush(request.ctx)
+			go wait(a.inflight, request.flushed)
+		case <-a.quit:
+			a.drain()
+			a.flush(a.ctx)
+			for _, sent := range a.inflight {
+				<-sent
+			}
+			return
+		}
+	}
+}
+
+// drain moves all messages waiting in the queue to the pending messages
+func (a *AsyncSender) drain() {
+	for {
+		select {
+		case result := <-a.queue:
+			a.add(result)
+		default:
+			return
+		}
+	}
+}
+
+func (a *AsyncSender) add(result *SendResult) {
+	size, err := result.Message.size()
+	if err != nil {
+		a.complete(result, err)
+		return
+	}
+
+	if len(a.pending) > 0 && a.pendingSize+size > a.flushSize {
+		a.flush(a.ctx)
+	}
+
+	a.pending = append(a.pending, result)
+	a.pendingSize += size
+
+	if len(a.pending) >= a.flushCount || a.pendingSize >= a.flushSize {
+		a.flush(a.ctx)
+	}
+}
+
+// flush sends the pending messages as a batch in the background, once
+// fewer than the maximum number of batches are in flight
+func (a *AsyncSender) flush(ctx context.Context) {
+	if len(a.pending) == 0 {
+		return
+	}
+
+	pending := a.pending
+	a.pending = nil
+	a.pendingSize = 0
+
+	select {
+	case a.slots <- struct{}{}:
+	case <-ctx.Done():
+		for _, result := range pending {
+			a.complete(result, ctx.Err())
+		}
+		return
+	}
+
+	sent := make(chan struct{})
+	a.inflight = append(inflight(a.inflight), sent)
+
+	go func() {
+		defer close(sent)
+		defer func() { <-a.slots }()
+		a.send(ctx, pending)
+	}()
+}
+
+// send sends messages as a batch, resending messages which cannot
+// be part of a batch, or were too large without compression, alone
+func (a *AsyncSender) send(ctx context.Context, pending []*SendResult) {
+	messages := make([]*Message, len(pending))
+	for i, result := range pending {
+		messages[i] = result.Message
+	}
+
+	errs := make([]error, len(pending))
+	err := a.sender.SendBatchContext(ctx, messages)
+
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		for _, failure := range batchErr.Failed {
+			errs[failure.Index] = failure.Err
+		}
+	} else if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	for i, result := range pending {
+		if errors.Is(errs[i], ErrInvalidMessage) || errors.Is(errs[i], ErrMessageTooLarge) {
+			errs[i] = a.sender.SendContext(ctx, result.Message)
+		}
+		a.complete(result, errs[i])
+	}
+}
+
+// inflight returns the batches which are still being sent
+func inflight(batches []chan struct{}) []chan struct{} {
+	var sending []chan struct{}
+	for _, sent := range batches {
+		select {
+		case <-sent:
+		default:
+			sending = append(sending, sent)
+		}
+	}
+	return sending
+}
+
+// wait closes done once all batches have been sent
+func wait(batches []chan struct{}, done chan struct{}) {
+	for _, sent := range batches {
+		<-sent
+	}
+	close(done)
+}
+
+func (a *AsyncSender) complete(result *SendResult, err error) {
+	result.complete(err)
+	if a.callback != nil {
+		a.callback(result.Message, err)
+	}
+}
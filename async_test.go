@@ -0,0 +1,283 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSender is a Sender recording every sent message,
+// failing messages with a body of "fail"
+type recordingSender struct {
+	mu      sync.Mutex
+	sent    []*Message
+	batches int
+}
+
+func (s *recordingSender) Send(message *Message) error {
+	return s.SendContext(context.Background(), message)
+}
+
+func (s *recordingSender) SendContext(ctx context.Context, message *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if string(message.Body) == "fail" {
+		return ErrThrottled
+	}
+	s.sent = append(s.sent, message)
+	return nil
+}
+
+func (s *recordingSender) SendBatch(messages []*Message) error {
+	return s.SendBatchContext(context.Background(), messages)
+}
+
+func (s *recordingSender) SendBatchContext(ctx context.Context, messages []*Message) error {
+	s.mu.Lock()
+	s.batches++
+	s.mu.Unlock()
+
+	batchErr := &BatchError{Total: len(messages)}
+	for i, message := range messages {
+		if err := s.SendContext(ctx, message); err != nil {
+			batchErr.Failed = append(batchErr.Failed, BatchFailure{Index: i, Message: message, Err: err})
+		}
+	}
+
+	if len(batchErr.Failed) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+func (s *recordingSender) SendAt(message *Message, at time.Time) error {
+	return s.SendAtContext(context.Background(), message, at)
+}
+
+func (s *recordingSender) SendAtContext(ctx context.Context, message *Message, at time.Time) error {
+	message.ScheduledEnqueueTimeUtc = dateTime{at}
+	return s.SendContext(ctx, message)
+}
+
+func (s *recordingSender) SendAfter(message *Message, delay time.Duration) error {
+	return s.SendAfterContext(context.Background(), message, delay)
+}
+
+func (s *recordingSender) SendAfterContext(ctx context.Context, message *Message, delay time.Duration) error {
+	return s.SendAtContext(ctx, message, time.Now().Add(delay))
+}
+
+func (s *recordingSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+func TestAsyncSenderFlushByCount(t *testing.T) {
+	sender := &recordingSender{}
+	async := NewAsyncSender(sender, WithFlushCount(2), WithFlushInterval(time.Hour))
+	defer async.Close(context.Background())
+
+	first, _ := async.Send(&Message{Body: []byte("1")})
+	second, _ := async.Send(&Message{Body: []byte("2")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := first.Wait(ctx); err != nil {
+		t.Errorf("First message was not sent: %v", err)
+	}
+	if err := second.Wait(ctx); err != nil {
+		t.Errorf("Second message was not sent: %v", err)
+	}
+	if sender.count() != 2 {
+		t.Errorf("Sent %d messages, expected 2.", sender.count())
+	}
+	if sender.batches != 1 {
+		t.Errorf("Messages were sent in %d batches, expected 1.", sender.batches)
+	}
+}
+
+func TestAsyncSenderFlushAndClose(t *testing.T) {
+	sender := &recordingSender{}
+	var mu sync.Mutex
+	var failed []*Message
+	async := NewAsyncSender(sender,
+		WithFlushInterval(time.Hour),
+		WithResultCallback(func(message *Message, err error) {
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, message)
+				mu.Unlock()
+			}
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	async.Send(&Message{Body: []byte("1")})
+	result, _ := async.Send(&Message{Body: []byte("fail")})
+	if err := async.Flush(ctx); err != nil {
+		t.Errorf("Could not flush: %v", err)
+	}
+	if sender.count() != 1 {
+		t.Errorf("Flush did not send queued messages.")
+	}
+	if !errors.Is(result.Err(), ErrThrottled) {
+		t.Errorf("Failed message did not get its error.")
+	}
+	if len(failed) != 1 {
+		t.Errorf("Callback was not invoked for the failed message.")
+	}
+
+	async.Send(&Message{Body: []byte("2")})
+	if err := async.Close(ctx); err != nil {
+		t.Errorf("Could not close: %v", err)
+	}
+	if sender.count() != 2 {
+		t.Errorf("Close did not send queued messages.")
+	}
+	if _, err := async.Send(&Message{Body: []byte("3")}); err != ErrSenderClosed {
+		t.Errorf("Closed sender accepted a message.")
+	}
+}
+
+// blockingSender is a Sender whose sends only
+// return once their context is done
+type blockingSender struct {
+	recordingSender
+}
+
+func (s *blockingSender) SendContext(ctx context.Context, message *Message) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *blockingSender) SendBatchContext(ctx context.Context, messages []*Message) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAsyncSenderCloseCancelsSends(t *testing.T) {
+	async := NewAsyncSender(&blockingSender{}, WithFlushInterval(time.Hour))
+
+	result, _ := async.Send(&Message{Body: []byte("1")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	if err := async.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Close returned %v, expected context.DeadlineExceeded.", err)
+	}
+	if time.Since(started) > time.Second {
+		t.Errorf("Close did not give up when the context was done.")
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if err := result.Wait(waitCtx); err != context.Canceled {
+		t.Errorf("Message in flight returned %v, expected context.Canceled.", err)
+	}
+}
+
+func TestAsyncSenderFlushCancelsSends(t *testing.T) {
+	async := NewAsyncSender(&blockingSender{}, WithFlushInterval(time.Hour))
+	defer async.Close(context.Background())
+
+	result, _ := async.Send(&Message{Body: []byte("1")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := async.Flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Flush returned %v, expected context.DeadlineExceeded.", err)
+	}
+	if err := result.Wait(context.Background()); err != context.DeadlineExceeded {
+		t.Errorf("Message in flight returned %v, expected context.DeadlineExceeded.", err)
+	}
+}
+
+func TestAsyncSenderCloseWithFullQueue(t *testing.T) {
+	async := NewAsyncSender(&blockingSender{}, WithQueueSize(1), WithFlushCount(1), WithFlushConcurrency(1), WithFlushInterval(time.Hour))
+
+	// One message in flight, one waiting to be flushed and one queued
+	async.Send(&Message{Body: []byte("1")})
+	time.Sleep(10 * time.Millisecond)
+	async.Send(&Message{Body: []byte("2")})
+	time.Sleep(10 * time.Millisecond)
+	async.Send(&Message{Body: []byte("3")})
+
+	blocked := make(chan error)
+	go func() {
+		_, err := async.Send(&Message{Body: []byte("4")})
+		blocked <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	async.Close(ctx)
+
+	select {
+	case err := <-blocked:
+		if err != ErrSenderClosed {
+			t.Errorf("Blocked Send returned %v, expected ErrSenderClosed.", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Close did not release a Send waiting for room in the queue.")
+	}
+}
+
+// slowSender is a recordingSender taking a while to send each batch
+type slowSender struct {
+	recordingSender
+	delay time.Duration
+}
+
+func (s *slowSender) SendBatchContext(ctx context.Context, messages []*Message) error {
+	time.Sleep(s.delay)
+	return s.recordingSender.SendBatchContext(ctx, messages)
+}
+
+func TestAsyncSenderSendsBatchesConcurrently(t *testing.T) {
+	sender := &slowSender{delay: 200 * time.Millisecond}
+	async := NewAsyncSender(sender, WithFlushCount(1), WithFlushConcurrency(4), WithFlushInterval(time.Hour))
+
+	started := time.Now()
+	for i := 0; i < 4; i++ {
+		async.Send(&Message{Body: []byte("1")})
+	}
+	if err := async.Close(context.Background()); err != nil {
+		t.Errorf("Could not close: %v", err)
+	}
+
+	if sender.count() != 4 {
+		t.Errorf("Sent %d messages, expected 4.", sender.count())
+	}
+	if elapsed := time.Since(started); elapsed > 600*time.Millisecond {
+		t.Errorf("Sending 4 batches took %s, they were not sent concurrently.", elapsed)
+	}
+}
+
+func TestAsyncSenderSendsBinaryBodiesAlone(t *testing.T) {
+	client, queue, ts := newTestQueueClient(t)
+	defer ts.Close()
+
+	async := NewAsyncSender(client, WithFlushInterval(time.Hour))
+	binary, _ := async.Send(&Message{Body: []byte{0xff, 0x00, 0xfe}})
+	text, _ := async.Send(&Message{Body: []byte("text")})
+	if err := async.Close(context.Background()); err != nil {
+		t.Errorf("Could not close: %v", err)
+	}
+
+	if binary.Err() != nil || text.Err() != nil {
+		t.Fatalf("Messages were not sent: %v, %v", binary.Err(), text.Err())
+	}
+	if len(queue.messages) != 2 || string(queue.messages[1].body) != "\xff\x00\xfe" {
+		t.Errorf("Binary body was not sent alone.")
+	}
+}
@@ -0,0 +1,205 @@
+package azureservicebus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+)
+
+const batchContentType = "application/vnd.microsoft.servicebus.json"
+
+// BatchFailure describes a message in a batch which could not be sent
+type BatchFailure struct {
+	Index   int
+	Message *Message
+	Err     error
+}
+
+// BatchError is returned when one or more messages of a batch could
+// not be sent. Messages which are not listed as failed have been sent.
+type BatchError struct {
+	Total  int
+	Failed []BatchFailure
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("Could not send %d of %d messages in batch: %v", len(e.Failed), e.Total, e.Failed[0].Err)
+}
+
+// Unwrap returns the error of the first failed message
+func (e *BatchError) Unwrap() error {
+	return e.Failed[0].Err
+}
+
+type batchElement struct {
+	Body             string                 `json:"Body"`
+	BrokerProperties *batchBrokerProperties `json:"BrokerProperties,omitempty"`
+	UserProperties   map[string]interface{} `json:"UserProperties,omitempty"`
+}
+
+// batchBrokerProperties adds the content type, which single
+// messages carry in the Content-Type header, to the broker
+// properties of a batch element
+type batchBrokerProperties struct {
+	brokerProperties
+	ContentType string `json:"ContentType,omitempty"`
+}
+
+type encodedMessage struct {
+	index    int
+	outgoing *Message
+	data     []byte
+}
+
+func encodeBatchElement(message *Message) ([]byte, error) {
+	if err := message.Validate(); err != nil {
+		return nil, err
+	}
+	// Batch bodies are JSON strings, which cannot hold binary data
+	if !utf8.Valid(message.Body) {
+		return nil, fmt.Errorf("%w: body is not valid UTF-8 and cannot be sent in a batch", ErrInvalidMessage)
+	}
+
+	userProperties, err := message.Properties.batchPropertyValues()
+	if err != nil {
+		return nil, err
+	}
+
+	element := batchElement{
+		Body:           string(message.Body),
+		UserProperties: userProperties,
+	}
+	props := batchBrokerProperties{
+		brokerProperties: *message.brokerProperties(),
+		ContentType:      message.ContentType,
+	}
+	if props != (batchBrokerProperties{}) {
+		element.BrokerProperties = &props
+	}
+
+	return json.Marshal(element)
+}
+
+// splitBatch groups encoded messages into chunks whose serialized
+// JSON array does not exceed the limit
+func splitBatch(encoded []encodedMessage, limit int) [][]encodedMessage {
+	var chunks [][]encodedMessage
+	var current []encodedMessage
+	size := 2
+
+	for _, e := range encoded {
+		if len(current) > 0 && size+1+len(e.data) > limit {
+			chunks = append(chunks, current)
+			current = nil
+			size = 2
+		}
+		if len(current) > 0 {
+			size++
+		}
+		current = append(current, e)
+		size += len(e.data)
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+func sendBatch(ctx context.Context, client *HTTPRequestClient, entityPath string, messages []*Message) error {
+	batchErr := &BatchError{Total: len(messages)}
+	fail := func(index int, err error) {
+		batchErr.Failed = append(batchErr.Failed, BatchFailure{Index: index, Message: messages[index], Err: err})
+	}
+
+	var encoded []encodedMessage
+	for i, message := range messages {
+		if err := applyMessageID(client, message); err != nil {
+			fail(i, err)
+			continue
+		}
+
+		// Compressed bodies are binary, which batch elements cannot hold
+		outgoing, err := interceptOutgoing(ctx, client, message, false)
+		if err != nil {
+			fail(i, err)
+			continue
+		}
+
+		data, err := encodeBatchElement(outgoing)
+		if err == nil && len(data)+2 > client.maxMessageSize {
+			err = &MessageTooLargeError{Size: len(data) + 2, Limit: client.maxMessageSize}
+		}
+		if err != nil {
+			interceptSendFailed(client, outgoing)
+			fail(i, err)
+			continue
+		}
+		encoded = append(encoded, encodedMessage{index: i, outgoing: outgoing, data: data})
+	}
+
+	for _, chunk := range splitBatch(encoded, client.maxMessageSize) {
+		requested := false
+		err := ctx.Err()
+		if err == nil {
+			requested, err = sendBatchChunk(ctx, client, entityPath, chunk)
+		}
+		if err != nil {
+			for _, e := range chunk {
+				if !requested {
+					interceptSendFailed(client, e.outgoing)
+				}
+				fail(e.index, err)
+			}
+		}
+	}
+
+	if len(batchErr.Failed) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// sendBatchChunk sends a chunk of encoded messages. requested is false
+// when the chunk was rejected before or by the service, and true when
+// it may have been stored.
+func sendBatchChunk(ctx context.Context, client *HTTPRequestClient, entityPath string, chunk []encodedMessage) (requested bool, err error) {
+	target, err := client.NewRequestURL(fmt.Sprintf("/%s/messages/", entityPath))
+	if err != nil {
+		return false, err
+	}
+
+	var body bytes.Buffer
+	body.WriteByte('[')
+	for i, e := range chunk {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(e.data)
+	}
+	body.WriteByte(']')
+
+	req, err := client.NewRequest(target, "POST", body.Bytes())
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", batchContentType)
+
+	resp, err := client.ExecuteContext(ctx, req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return false, newError("send message batch", entityPath, resp)
+	}
+
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return true, err
+}
@@ -0,0 +1,154 @@
+package azureservicebus
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSendBatchSplitsRequests(t *testing.T) {
+	var batches [][]batchElement
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != batchContentType {
+			t.Errorf("Batch was not sent with batch content type.")
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		if len(data) > 200 {
+			t.Errorf("Batch request exceeded the maximum message size.")
+		}
+
+		var batch []batchElement
+		if err := json.Unmarshal(data, &batch); err != nil {
+			t.Errorf("Batch was not valid JSON.")
+		}
+		batches = append(batches, batch)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	hrc.maxMessageSize = 200
+
+	messages := []*Message{
+		{MessageID: "1", Body: []byte(strings.Repeat("a", 50))},
+		{MessageID: "2", Body: []byte(strings.Repeat("b", 50))},
+		{MessageID: "3", Body: []byte(strings.Repeat("c", 500))},
+		{MessageID: "4", Body: []byte(strings.Repeat("d", 50))},
+	}
+
+	err := newSender(hrc, "test-queue").SendBatch(messages)
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Oversized message in batch did not return a BatchError.")
+	}
+	if len(batchErr.Failed) != 1 || batchErr.Failed[0].Index != 2 {
+		t.Errorf("BatchError did not report the oversized message.")
+	}
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("BatchError did not match ErrMessageTooLarge.")
+	}
+
+	if len(batches) != 2 {
+		t.Fatalf("Batch was split into %d requests, expected 2.", len(batches))
+	}
+	if batches[0][0].BrokerProperties.MessageID != "1" || batches[1][0].BrokerProperties.MessageID != "4" {
+		t.Errorf("Batch requests did not preserve message order.")
+	}
+}
+
+func TestSendBatchRequestFailure(t *testing.T) {
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	err := newSender(hrc, "test-queue").SendBatch([]*Message{{Body: []byte("a")}, {Body: []byte("b")}})
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 2 {
+		t.Errorf("Failed batch request did not report all messages as failed.")
+	}
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("BatchError did not match ErrUnauthorized.")
+	}
+}
+
+func TestSendBatchContentType(t *testing.T) {
+	var batch []batchElement
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &batch)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	messages := []*Message{
+		{ContentType: "application/json", Body: []byte(`{"a":1}`)},
+		{Body: []byte("text")},
+	}
+	if err := newSender(hrc, "test-queue").SendBatch(messages); err != nil {
+		t.Fatalf("Could not send batch: %v", err)
+	}
+
+	if len(batch) != 2 {
+		t.Fatalf("Batch contained %d messages, expected 2.", len(batch))
+	}
+	if batch[0].BrokerProperties == nil || batch[0].BrokerProperties.ContentType != "application/json" {
+		t.Errorf("Batch element did not carry the content type.")
+	}
+	if batch[1].BrokerProperties != nil {
+		t.Errorf("Batch element without broker properties was not left empty.")
+	}
+}
+
+func TestSendBatchRejectsBinaryBodies(t *testing.T) {
+	var batch []batchElement
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &batch)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	messages := []*Message{
+		{Body: []byte("text")},
+		{Body: []byte{0x1f, 0x8b, 0xff, 0x00}},
+	}
+	err := newSender(hrc, "test-queue").SendBatch(messages)
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 1 || batchErr.Failed[0].Index != 1 {
+		t.Fatalf("Binary body in batch was not reported as failed.")
+	}
+	if !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("BatchError did not match ErrInvalidMessage.")
+	}
+	if len(batch) != 1 || batch[0].Body != "text" {
+		t.Errorf("Valid messages of the batch were not sent.")
+	}
+}
+
+func TestSendBatchWithCompression(t *testing.T) {
+	var batch []batchElement
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &batch)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	WithCompression(CompressionGzip, 10)(hrc)
+
+	body := strings.Repeat("a", 100)
+	if err := newSender(hrc, "test-queue").SendBatch([]*Message{{Body: []byte(body)}}); err != nil {
+		t.Fatalf("Could not send batch with compression enabled: %v", err)
+	}
+	if len(batch) != 1 || batch[0].Body != body {
+		t.Errorf("Batch element was not sent uncompressed.")
+	}
+	if _, ok := batch[0].UserProperties[ContentEncodingProperty]; ok {
+		t.Errorf("Batch element was marked as compressed.")
+	}
+}
@@ -0,0 +1,154 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChannelTimeout = 30
+	channelRetryDelay     = time.Second
+)
+
+// ChannelReceiverOption configures a ChannelReceiver
+type ChannelReceiverOption func(*ChannelReceiver)
+
+// WithChannelTimeout sets how long, in seconds, every
+// receive waits for a message
+func WithChannelTimeout(timeout int) ChannelReceiverOption {
+	return func(c *ChannelReceiver) {
+		c.timeout = timeout
+	}
+}
+
+// WithDestructiveRead makes the ChannelReceiver receive with
+// DestructiveRead instead of PeekLockMessage
+func WithDestructiveRead() ChannelReceiverOption {
+	return func(c *ChannelReceiver) {
+		c.destructive = true
+	}
+}
+
+// ChannelReceiver delivers messages from a Receiver on a channel.
+// The channel is unbuffered, so no message is received until the
+// previous one has been read from the channel.
+type ChannelReceiver struct {
+	receiver    Receiver
+	timeout     int
+	destructive bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewChannelReceiver creates a ChannelReceiver receiving
+// messages from the receiver
+func NewChannelReceiver(receiver Receiver, opts ...ChannelReceiverOption) *ChannelReceiver {
+	c := &ChannelReceiver{
+		receiver: receiver,
+		timeout:  defaultChannelTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Receive returns a channel of received messages, which is closed when
+// ctx is done or receiving fails with ErrUnauthorized or
+// ErrEntityNotFound; Err then returns the reason. Other errors, such
+// as throttling and timeouts, are retried after a delay. A
+// peek-locked message which could not be delivered before ctx is done
+// is unlocked when the Receiver is also a Settler, while a message read
+// destructively is lost.
+func (c *ChannelReceiver) Receive(ctx context.Context) <-chan *Message {
+	c.setErr(nil)
+
+	messages := make(chan *Message)
+	go func() {
+		defer close(messages)
+		c.setErr(c.receive(ctx, messages))
+	}()
+
+	return messages
+}
+
+// Err returns the error which closed the channel
+// returned by the last call to Receive
+func (c *ChannelReceiver) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *ChannelReceiver) setErr(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+func (c *ChannelReceiver) receive(ctx context.Context, messages chan<- *Message) error {
+	for {
+		msg, err := c.next(ctx)
+		if ctx.Err() != nil {
+			c.release(msg)
+			return ctx.Err()
+		}
+		if err != nil {
+			c.release(msg)
+			if !retryableReceiveError(err) {
+				return err
+			}
+
+			select {
+			case <-time.After(channelRetryDelay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			c.release(msg)
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *ChannelReceiver) next(ctx context.Context) (*Message, error) {
+	if !c.destructive {
+		return c.receiver.PeekLockMessageContext(ctx, c.timeout)
+	}
+
+	msg, err := c.receiver.DestructiveReadContext(ctx, c.timeout)
+	if errors.Is(err, ErrNoMessage) {
+		return nil, nil
+	}
+	return msg, err
+}
+
+// release unlocks an undelivered peek-locked message
+func (c *ChannelReceiver) release(msg *Message) {
+	if msg == nil || c.destructive {
+		return
+	}
+
+	if settler, ok := c.receiver.(Settler); ok {
+		settler.UnlockContext(context.Background(), msg)
+	}
+}
+
+// retryableReceiveError reports whether receiving may succeed when
+// retried, which it cannot without credentials or an entity
+func retryableReceiveError(err error) bool {
+	return !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrEntityNotFound)
+}
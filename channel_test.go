@@ -0,0 +1,133 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingReceiver is a Receiver failing its first failures
+// receives, or every receive when failures is negative
+type failingReceiver struct {
+	*memoryConsumer
+	err      error
+	failures int
+}
+
+func (r *failingReceiver) PeekLockMessageContext(ctx context.Context, timeout int) (*Message, error) {
+	if r.failures != 0 {
+		r.failures--
+		return nil, r.err
+	}
+	return r.memoryConsumer.PeekLockMessageContext(ctx, timeout)
+}
+
+func TestChannelReceiverDeliversMessages(t *testing.T) {
+	consumer := newMemoryConsumer(&Message{Body: []byte("a")}, &Message{Body: []byte("b")})
+	c := NewChannelReceiver(consumer, WithChannelTimeout(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := c.Receive(ctx)
+
+	var bodies []string
+	for msg := range messages {
+		bodies = append(bodies, string(msg.Body))
+		if len(bodies) == 2 {
+			cancel()
+		}
+	}
+
+	if len(bodies) != 2 || bodies[0] != "a" || bodies[1] != "b" {
+		t.Errorf("Received %v, expected [a b].", bodies)
+	}
+	if c.Err() != context.Canceled {
+		t.Errorf("Err returned %v, expected context.Canceled.", c.Err())
+	}
+}
+
+func TestChannelReceiverUnlocksUndeliveredMessage(t *testing.T) {
+	consumer := newMemoryConsumer(&Message{Body: []byte("a")}, &Message{Body: []byte("b")})
+	c := NewChannelReceiver(consumer, WithChannelTimeout(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := c.Receive(ctx)
+	<-messages
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	for range messages {
+	}
+
+	if _, unlocked := consumer.settled(); unlocked != 1 {
+		t.Errorf("Undelivered message was not unlocked.")
+	}
+}
+
+func TestChannelReceiverDestructiveRead(t *testing.T) {
+	consumer := newMemoryConsumer(&Message{Body: []byte("a")})
+	c := NewChannelReceiver(consumer, WithChannelTimeout(1), WithDestructiveRead())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	count := 0
+	for range c.Receive(ctx) {
+		count++
+	}
+
+	if count != 1 {
+		t.Errorf("Received %d messages, expected 1.", count)
+	}
+	if c.Err() != context.DeadlineExceeded {
+		t.Errorf("Err returned %v, expected context.DeadlineExceeded.", c.Err())
+	}
+}
+
+func TestChannelReceiverClosesOnError(t *testing.T) {
+	c := NewChannelReceiver(&failingReceiver{newMemoryConsumer(), ErrUnauthorized, -1})
+
+	for range c.Receive(context.Background()) {
+		t.Errorf("Received a message from a failing receiver.")
+	}
+
+	if !errors.Is(c.Err(), ErrUnauthorized) {
+		t.Errorf("Err returned %v, expected ErrUnauthorized.", c.Err())
+	}
+}
+
+func TestChannelReceiverRetriesThrottling(t *testing.T) {
+	receiver := &failingReceiver{newMemoryConsumer(&Message{Body: []byte("a")}), ErrThrottled, 1}
+	c := NewChannelReceiver(receiver, WithChannelTimeout(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	select {
+	case msg, ok := <-c.Receive(ctx):
+		if !ok || string(msg.Body) != "a" {
+			t.Errorf("Channel was closed by a throttled receive: %v", c.Err())
+		}
+	case <-ctx.Done():
+		t.Errorf("Message was not received after a throttled receive.")
+	}
+}
+
+func TestChannelReceiverIdleQueue(t *testing.T) {
+	client, _, ts := newTestQueueClient(t)
+	defer ts.Close()
+
+	c := NewChannelReceiver(client, WithChannelTimeout(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	for range c.Receive(ctx) {
+		t.Errorf("Received a message from an empty queue.")
+	}
+
+	if c.Err() != context.DeadlineExceeded {
+		t.Errorf("Channel on an idle queue was closed by %v.", c.Err())
+	}
+}
@@ -0,0 +1,169 @@
+package azureservicebus
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ClaimCheckProperty is the custom property holding the reference
+// to a message body offloaded to a BlobStore
+const ClaimCheckProperty = "ClaimCheck"
+
+// BlobStore stores message bodies offloaded by a ClaimCheck
+type BlobStore interface {
+	Put(ctx context.Context, data []byte) (string, error)
+	Get(ctx context.Context, ref string) ([]byte, error)
+	Delete(ctx context.Context, ref string) error
+}
+
+// FileBlobStore stores blobs as files in a directory, which senders
+// and receivers must share, for example through a network mount
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore creates a blob store in dir, creating the
+// directory if it does not exist
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileBlobStore{dir: dir}, nil
+}
+
+func (s *FileBlobStore) path(ref string) (string, error) {
+	if ref == "" || strings.ContainsAny(ref, `/\`) || ref == "." || ref == ".." {
+		return "", fmt.Errorf("Invalid blob reference %q", ref)
+	}
+
+	return filepath.Join(s.dir, ref), nil
+}
+
+// Put writes a blob to a new file, returning its name as reference
+func (s *FileBlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	ref, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	path, err := s.path(ref)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// Get reads a blob
+func (s *FileBlobStore) Get(ctx context.Context, ref string) ([]byte, error) {
+	path, err := s.path(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// Delete removes a blob, ignoring blobs which do not exist
+func (s *FileBlobStore) Delete(ctx context.Context, ref string) error {
+	path, err := s.path(ref)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ClaimCheck is an Interceptor offloading message bodies larger than
+// a threshold to a BlobStore, sending a reference in the ClaimCheck
+// property instead. Received messages are rehydrated from the store,
+// and the blob is deleted once the message is deleted, or when the
+// service did not accept it.
+//
+// Add it after any interceptor transforming the body, such as
+// compression or encryption, so the stored blob is transformed too.
+// Blobs of messages which expire or are dead-lettered are not removed.
+type ClaimCheck struct {
+	store     BlobStore
+	threshold int
+}
+
+// NewClaimCheck creates a ClaimCheck offloading bodies of
+// more than threshold bytes
+func NewClaimCheck(store BlobStore, threshold int) *ClaimCheck {
+	return &ClaimCheck{store: store, threshold: threshold}
+}
+
+// WithClaimCheck offloads message bodies of more than threshold
+// bytes to the store
+func WithClaimCheck(store BlobStore, threshold int) Option {
+	return WithInterceptor(NewClaimCheck(store, threshold))
+}
+
+// OutgoingMessage offloads the body of a large message
+func (c *ClaimCheck) OutgoingMessage(ctx context.Context, message *Message) error {
+	if len(message.Body) <= c.threshold {
+		return nil
+	}
+
+	ref, err := c.store.Put(ctx, message.Body)
+	if err != nil {
+		return err
+	}
+
+	if message.Properties == nil {
+		message.Properties = make(Properties)
+	}
+	message.Properties[ClaimCheckProperty] = ref
+	message.Body = nil
+	return nil
+}
+
+// IncomingMessage rehydrates the body of an offloaded message
+func (c *ClaimCheck) IncomingMessage(ctx context.Context, message *Message) error {
+	ref, ok := message.Properties.String(ClaimCheckProperty)
+	if !ok {
+		return nil
+	}
+
+	body, err := c.store.Get(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("Could not read claim checked body %s: %w", ref, err)
+	}
+
+	message.Body = body
+	return nil
+}
+
+// SendFailed removes the blob of an offloaded message
+// which was not accepted by the service
+func (c *ClaimCheck) SendFailed(ctx context.Context, message *Message) {
+	ref, ok := message.Properties.String(ClaimCheckProperty)
+	if !ok {
+		return
+	}
+
+	// The blob is orphaned if it cannot be removed either
+	c.store.Delete(ctx, ref)
+}
+
+// MessageDeleted removes the blob of an offloaded message
+func (c *ClaimCheck) MessageDeleted(ctx context.Context, message *Message) error {
+	ref, ok := message.Properties.String(ClaimCheckProperty)
+	if !ok {
+		return nil
+	}
+
+	return c.store.Delete(ctx, ref)
+}
@@ -0,0 +1,129 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimcheck")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory.")
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		t.Fatalf("Could not create file blob store: %v", err)
+	}
+
+	client, queue, ts := newTestQueueClient(t, WithMaxMessageSize(1024), WithClaimCheck(store, 100))
+	defer ts.Close()
+
+	body := strings.Repeat("x", 10*1024)
+	message := &Message{Body: []byte(body)}
+	if err := client.Send(message); err != nil {
+		t.Fatalf("Could not send claim checked message: %v", err)
+	}
+	if len(message.Body) != len(body) {
+		t.Errorf("Claim check modified the sent message.")
+	}
+	if len(queue.messages[0].body) != 0 {
+		t.Errorf("Large body was sent to the queue.")
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Large body was not offloaded to the blob store.")
+	}
+
+	msg, err := client.PeekLockMessage(1)
+	if err != nil {
+		t.Fatalf("Could not receive claim checked message: %v", err)
+	}
+	if string(msg.Body) != body {
+		t.Errorf("Received message was not rehydrated.")
+	}
+
+	if err := client.DeleteMessage(msg); err != nil {
+		t.Errorf("Could not delete claim checked message: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Blob was not deleted with the message.")
+	}
+}
+
+func TestClaimCheckBelowThreshold(t *testing.T) {
+	store := &FileBlobStore{dir: "does-not-exist"}
+	check := NewClaimCheck(store, 100)
+
+	message := &Message{Body: []byte("small")}
+	if err := check.OutgoingMessage(context.Background(), message); err != nil {
+		t.Errorf("Small message was offloaded: %v", err)
+	}
+	if _, ok := message.Properties.Get(ClaimCheckProperty); ok {
+		t.Errorf("Small message got a claim check reference.")
+	}
+}
+
+func TestFileBlobStoreRejectsPaths(t *testing.T) {
+	store := &FileBlobStore{dir: os.TempDir()}
+	if _, err := store.Get(context.Background(), "../secret"); err == nil {
+		t.Errorf("Blob reference outside the store was accepted.")
+	}
+}
+
+// failingInterceptor is an Interceptor failing every outgoing message
+type failingInterceptor struct{}
+
+func (failingInterceptor) OutgoingMessage(ctx context.Context, message *Message) error {
+	return errors.New("interceptor failed")
+}
+
+func (failingInterceptor) IncomingMessage(ctx context.Context, message *Message) error {
+	return nil
+}
+
+func TestClaimCheckRemovesBlobWhenSendFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimcheck")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory.")
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := NewFileBlobStore(dir)
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer ts.Close()
+	WithClaimCheck(store, 100)(hrc)
+
+	sender := newSender(hrc, "test-queue")
+	body := []byte(strings.Repeat("x", 1024))
+
+	for i := 0; i < 3; i++ {
+		if err := sender.Send(&Message{Body: body}); !errors.Is(err, ErrThrottled) {
+			t.Errorf("Send returned %v, expected ErrThrottled.", err)
+		}
+	}
+	if err := sender.Send(&Message{TimeToLive: -1, Body: body}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Send returned %v, expected ErrInvalidMessage.", err)
+	}
+	if err := sender.SendBatch([]*Message{{Body: body}, {Body: body}}); !errors.Is(err, ErrThrottled) {
+		t.Errorf("SendBatch returned %v, expected ErrThrottled.", err)
+	}
+
+	WithInterceptor(failingInterceptor{})(hrc)
+	if err := sender.Send(&Message{Body: body}); err == nil {
+		t.Errorf("Send through a failing interceptor succeeded.")
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d blobs of messages which were not sent were left in the store.", len(files))
+	}
+}
@@ -1,6 +1,7 @@
 package azureservicebus
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,62 +10,176 @@ import (
 	"time"
 )
 
-// Client contain methods to communicate with Azure Service Bus over HTTPS
-type Client interface {
+// Sender contain methods to send messages to an Azure Service Bus
+// queue or topic. Every operation has a Context variant which honors
+// cancellation and deadlines of the given context.
+type Sender interface {
 	Send(message *Message) error
+	SendContext(ctx context.Context, message *Message) error
+	SendBatch(messages []*Message) error
+	SendBatchContext(ctx context.Context, messages []*Message) error
+	SendAt(message *Message, at time.Time) error
+	SendAtContext(ctx context.Context, message *Message, at time.Time) error
+	SendAfter(message *Message, delay time.Duration) error
+	SendAfterContext(ctx context.Context, message *Message, delay time.Duration) error
+}
+
+// Receiver contain methods to receive messages from an Azure Service Bus
+// queue or subscription. Every operation has a Context variant which
+// honors cancellation and deadlines of the given context, including
+// during long polling.
+type Receiver interface {
 	PeekLockMessage(timeout int) (*Message, error)
+	PeekLockMessageContext(ctx context.Context, timeout int) (*Message, error)
+	DestructiveRead(timeout int) (*Message, error)
+	DestructiveReadContext(ctx context.Context, timeout int) (*Message, error)
+}
+
+// Settler contain methods to settle messages received with a
+// peek-lock. Every operation has a Context variant which honors
+// cancellation and deadlines of the given context.
+type Settler interface {
 	Unlock(message *Message) error
+	UnlockContext(ctx context.Context, message *Message) error
 	RenewLock(message *Message) error
-	DestructiveRead(timeout int) (*Message, error)
+	RenewLockContext(ctx context.Context, message *Message) error
 	DeleteMessage(message *Message) error
+	DeleteMessageContext(ctx context.Context, message *Message) error
+}
+
+// Consumer receives messages and settles their locks
+type Consumer interface {
+	Receiver
+	Settler
+}
+
+// Client contain methods to communicate with Azure Service Bus over HTTPS,
+// both sending and receiving messages
+type Client interface {
+	Sender
+	Receiver
+	Settler
+}
+
+type sender struct {
+	entityPath string
+	client     *HTTPRequestClient
+}
+
+type settler struct {
+	client *HTTPRequestClient
+}
+
+type receiver struct {
+	settler
+	entityPath string
+}
+
+type entityClient struct {
+	*sender
+	*receiver
 }
 
-type queueClient struct {
-	queueName string
-	client    *HTTPRequestClient
+func newSender(client *HTTPRequestClient, entityPath string) *sender {
+	return &sender{
+		entityPath: entityPath,
+		client:     client,
+	}
 }
 
-type pubsubClient struct {
-	topic        string
-	subscription string
-	client       *HTTPRequestClient
+func newReceiver(client *HTTPRequestClient, entityPath string) *receiver {
+	return &receiver{
+		settler:    settler{client: client},
+		entityPath: entityPath,
+	}
 }
 
-func send(client *HTTPRequestClient, path string, message *Message) error {
-	target, err := client.NewRequestURL(path)
+func queuePath(queueName string) string {
+	return queueName
+}
+
+func subscriptionPath(topic string, subscription string) string {
+	return fmt.Sprintf("%s/subscriptions/%s", topic, subscription)
+}
+
+func send(ctx context.Context, client *HTTPRequestClient, entityPath string, message *Message) error {
+	target, err := client.NewRequestURL(fmt.Sprintf("/%s/messages/", entityPath))
 	if err != nil {
 		return err
 	}
 
-	req, err := client.NewRequest(target, "POST", message.Body)
+	if err := applyMessageID(client, message); err != nil {
+		return err
+	}
+
+	outgoing, err := interceptOutgoing(ctx, client, message, true)
 	if err != nil {
 		return err
 	}
 
-	for key, value := range message.Properties {
-		req.Header[key] = []string{value}
+	requested, err := sendOutgoing(ctx, client, target, entityPath, outgoing)
+	if err != nil && !requested {
+		interceptSendFailed(client, outgoing)
+	}
+	return err
+}
+
+// sendOutgoing validates and sends a message transformed by the
+// interceptors. requested is false when the message was rejected
+// before or by the service, and true when it may have been stored.
+func sendOutgoing(ctx context.Context, client *HTTPRequestClient, target *url.URL, entityPath string, message *Message) (requested bool, err error) {
+	if err := message.Validate(); err != nil {
+		return false, err
 	}
 
-	resp, err := client.Execute(req)
+	size, err := message.size()
 	if err != nil {
-		return err
+		return false, err
+	}
+	if size > client.maxMessageSize {
+		return false, &MessageTooLargeError{Size: size, Limit: client.maxMessageSize}
 	}
-	defer resp.Body.Close()
 
-	_, err = io.Copy(ioutil.Discard, resp.Body)
+	props, err := message.marshalBrokerProperties()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		return nil
+	req, err := client.NewRequest(target, "POST", message.Body)
+	if err != nil {
+		return false, err
 	}
 
-	return fmt.Errorf("Could not send message. Server returned error %d", resp.StatusCode)
+	if props != nil {
+		req.Header.Set("BrokerProperties", string(props))
+	}
+	if message.ContentType != "" {
+		req.Header.Set("Content-Type", message.ContentType)
+	}
+	for key, value := range message.Properties {
+		encoded, err := encodePropertyValue(value)
+		if err != nil {
+			return false, err
+		}
+		req.Header[key] = []string{encoded}
+	}
+
+	resp, err := client.ExecuteContext(ctx, req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return false, newError("send message", entityPath, resp)
+	}
+
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return true, err
 }
 
-func peekLockMessage(client *HTTPRequestClient, path string, timeout int) (*Message, error) {
-	target, err := client.NewRequestURL(path)
+func peekLockMessage(ctx context.Context, client *HTTPRequestClient, entityPath string, timeout int) (*Message, error) {
+	target, err := client.NewRequestURL(fmt.Sprintf("/%s/messages/head?timeout=%d", entityPath, timeout))
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +189,7 @@ func peekLockMessage(client *HTTPRequestClient, path string, timeout int) (*Mess
 		return nil, err
 	}
 
-	resp, err := client.ExecuteWithTimeout(req, time.Duration(timeout)*time.Second)
+	resp, err := client.ExecuteWithTimeoutContext(ctx, req, client.pollTimeout(timeout))
 	if err != nil {
 		return nil, err
 	}
@@ -83,16 +198,23 @@ func peekLockMessage(client *HTTPRequestClient, path string, timeout int) (*Mess
 	if resp.StatusCode == http.StatusNoContent {
 		return nil, nil
 	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, newError("peek lock message", entityPath, resp)
+	}
 
-	msg, err := ResponseToMessage(resp)
+	msg, err := responseToMessage(resp)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := interceptIncoming(ctx, client, msg); err != nil {
+		return msg, err
+	}
+
 	return msg, nil
 }
 
-func unlockMessage(client *HTTPRequestClient, message *Message) error {
+func unlockMessage(ctx context.Context, client *HTTPRequestClient, message *Message) error {
 	target, err := url.Parse(message.Location)
 	if err != nil {
 		return err
@@ -103,25 +225,21 @@ func unlockMessage(client *HTTPRequestClient, message *Message) error {
 		return err
 	}
 
-	resp, err := client.Execute(req)
+	resp, err := client.ExecuteContext(ctx, req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	_, err = io.Copy(ioutil.Discard, resp.Body)
-	if err != nil {
-		return err
+	if resp.StatusCode != http.StatusOK {
+		return newLockError("unlock message", message, resp)
 	}
 
-	if resp.StatusCode == http.StatusOK {
-		return nil
-	}
-
-	return fmt.Errorf("Could not unlock message. Server returned error %d", resp.StatusCode)
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
 }
 
-func renewMessageLock(client *HTTPRequestClient, message *Message) error {
+func renewMessageLock(ctx context.Context, client *HTTPRequestClient, message *Message) error {
 	target, err := url.Parse(message.Location)
 	if err != nil {
 		return err
@@ -132,26 +250,22 @@ func renewMessageLock(client *HTTPRequestClient, message *Message) error {
 		return err
 	}
 
-	resp, err := client.Execute(req)
+	resp, err := client.ExecuteContext(ctx, req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	_, err = io.Copy(ioutil.Discard, resp.Body)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode == http.StatusOK {
-		return nil
+	if resp.StatusCode != http.StatusOK {
+		return newLockError("renew message lock", message, resp)
 	}
 
-	return fmt.Errorf("Could not renew message lock. Server returned error %d", resp.StatusCode)
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
 }
 
-func destructiveReadMessage(client *HTTPRequestClient, path string, timeout int) (*Message, error) {
-	target, err := client.NewRequestURL(path)
+func destructiveReadMessage(ctx context.Context, client *HTTPRequestClient, entityPath string, timeout int) (*Message, error) {
+	target, err := client.NewRequestURL(fmt.Sprintf("/%s/messages/head?timeout=%d", entityPath, timeout))
 	if err != nil {
 		return nil, err
 	}
@@ -161,21 +275,35 @@ func destructiveReadMessage(client *HTTPRequestClient, path string, timeout int)
 		return nil, err
 	}
 
-	resp, err := client.ExecuteWithTimeout(req, time.Duration(timeout)*time.Second)
+	resp, err := client.ExecuteWithTimeoutContext(ctx, req, client.pollTimeout(timeout))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	msg, err := ResponseToMessage(resp)
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, ErrNoMessage
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError("read message", entityPath, resp)
+	}
+
+	msg, err := responseToMessage(resp)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := interceptIncoming(ctx, client, msg); err != nil {
+		return msg, err
+	}
+	if err := interceptDeleted(ctx, client, msg); err != nil {
+		return msg, err
+	}
+
 	return msg, nil
 }
 
-func deleteMessage(client *HTTPRequestClient, message *Message) error {
+func deleteMessage(ctx context.Context, client *HTTPRequestClient, message *Message) error {
 	target, err := url.Parse(message.Location)
 	if err != nil {
 		return err
@@ -186,115 +314,200 @@ func deleteMessage(client *HTTPRequestClient, message *Message) error {
 		return err
 	}
 
-	resp, err := client.Execute(req)
+	resp, err := client.ExecuteContext(ctx, req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		return nil
+	if resp.StatusCode != http.StatusOK {
+		return newLockError("delete message", message, resp)
+	}
+
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return err
+	}
+
+	return interceptDeleted(ctx, client, message)
+}
+
+// Send a new message to the Azure Service Bus queue or topic
+func (c *sender) Send(message *Message) error {
+	return c.SendContext(context.Background(), message)
+}
+
+// SendContext sends a new message to the Azure Service Bus queue
+// or topic using the specified context
+func (c *sender) SendContext(ctx context.Context, message *Message) error {
+	return send(ctx, c.client, c.entityPath, message)
+}
+
+// SendBatch sends several messages to the Azure Service Bus queue or
+// topic, using as few requests as the maximum message size allows.
+// A *BatchError lists the messages which could not be sent. Message
+// bodies are sent as strings, so they are not compressed, and binary
+// bodies, such as encrypted ones, fail with ErrInvalidMessage.
+func (c *sender) SendBatch(messages []*Message) error {
+	return c.SendBatchContext(context.Background(), messages)
+}
+
+// SendBatchContext sends several messages to the Azure Service Bus
+// queue or topic using the specified context
+func (c *sender) SendBatchContext(ctx context.Context, messages []*Message) error {
+	return sendBatch(ctx, c.client, c.entityPath, messages)
+}
+
+// SendAt sends a new message to the Azure Service Bus queue or topic,
+// scheduled to be enqueued at the specified time. The time must be in
+// the future and within the time to live of the message.
+func (c *sender) SendAt(message *Message, at time.Time) error {
+	return c.SendAtContext(context.Background(), message, at)
+}
+
+// SendAtContext sends a new scheduled message to the Azure Service Bus
+// queue or topic using the specified context
+func (c *sender) SendAtContext(ctx context.Context, message *Message, at time.Time) error {
+	if err := message.schedule(at, time.Now()); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("Could not delete message. Server returned error %d", resp.StatusCode)
+	return c.SendContext(ctx, message)
 }
 
-// Send a new message to the Azure Service Bus Queue
-func (c *queueClient) Send(message *Message) error {
-	path := fmt.Sprintf("/%s/messages/", c.queueName)
-	return send(c.client, path, message)
+// SendAfter sends a new message to the Azure Service Bus queue or topic,
+// scheduled to be enqueued once the delay has passed
+func (c *sender) SendAfter(message *Message, delay time.Duration) error {
+	return c.SendAfterContext(context.Background(), message, delay)
 }
 
-// PeekLockMessage listens for a message without removing it
-// from the queue. The timeout should be specified in seconds.
-func (c *queueClient) PeekLockMessage(timeout int) (*Message, error) {
-	path := fmt.Sprintf("/%s/messages/head?timeout=%d", c.queueName, timeout)
-	return peekLockMessage(c.client, path, timeout)
+// SendAfterContext sends a new delayed message to the Azure Service Bus
+// queue or topic using the specified context
+func (c *sender) SendAfterContext(ctx context.Context, message *Message, delay time.Duration) error {
+	return c.SendAtContext(ctx, message, time.Now().Add(delay))
 }
 
-// Unlock a message in the queue to enable re-processing
-func (c *queueClient) Unlock(message *Message) error {
-	return unlockMessage(c.client, message)
+// PeekLockMessage listens for a message without removing it from
+// the queue or subscription. The timeout should be specified in seconds.
+// A nil message is returned when no message arrived before the timeout.
+func (c *receiver) PeekLockMessage(timeout int) (*Message, error) {
+	return c.PeekLockMessageContext(context.Background(), timeout)
 }
 
-// RenewLock a message in the queue to keep blocking re-processing
-func (c *queueClient) RenewLock(message *Message) error {
-	return renewMessageLock(c.client, message)
+// PeekLockMessageContext listens for a message without removing it
+// from the queue or subscription, until the timeout (in seconds) has
+// passed or the context is done.
+func (c *receiver) PeekLockMessageContext(ctx context.Context, timeout int) (*Message, error) {
+	return peekLockMessage(ctx, c.client, c.entityPath, timeout)
 }
 
-// DestructiveRead a message, removing it from the queue. The timeout
-// should be specified in seconds.
-func (c *queueClient) DestructiveRead(timeout int) (*Message, error) {
-	path := fmt.Sprintf("/%s/messages/head?timeout=%d", c.queueName, timeout)
-	return destructiveReadMessage(c.client, path, timeout)
+// DestructiveRead a message, removing it from the queue or subscription.
+// The timeout should be specified in seconds. ErrNoMessage is returned
+// when no message arrived before the timeout.
+func (c *receiver) DestructiveRead(timeout int) (*Message, error) {
+	return c.DestructiveReadContext(context.Background(), timeout)
 }
 
-// DeleteMessage from the queue
-func (c *queueClient) DeleteMessage(message *Message) error {
-	return deleteMessage(c.client, message)
+// DestructiveReadContext reads a message, removing it from the queue or
+// subscription, until the timeout (in seconds) has passed or the context
+// is done.
+func (c *receiver) DestructiveReadContext(ctx context.Context, timeout int) (*Message, error) {
+	return destructiveReadMessage(ctx, c.client, c.entityPath, timeout)
 }
 
-// Send a new message to the Azure Service Bus publisher
-func (c *pubsubClient) Send(message *Message) error {
-	path := fmt.Sprintf("/%s/messages/", c.topic)
-	return send(c.client, path, message)
+// Unlock a message to enable re-processing
+func (c *settler) Unlock(message *Message) error {
+	return c.UnlockContext(context.Background(), message)
 }
 
-// PeekLockMessage listens for a message without removing it
-// from the subscriber. The timeout should be specified in seconds.
-func (c *pubsubClient) PeekLockMessage(timeout int) (*Message, error) {
-	path := fmt.Sprintf("/%s/subscriptions/%s/messages/head?timeout=%d", c.topic, c.subscription, timeout)
-	return peekLockMessage(c.client, path, timeout)
+// UnlockContext unlocks a message using the specified context
+func (c *settler) UnlockContext(ctx context.Context, message *Message) error {
+	return unlockMessage(ctx, c.client, message)
 }
 
-// Unlock a message in the subscription to enable re-processing
-func (c *pubsubClient) Unlock(message *Message) error {
-	return unlockMessage(c.client, message)
+// RenewLock a message to keep blocking re-processing
+func (c *settler) RenewLock(message *Message) error {
+	return c.RenewLockContext(context.Background(), message)
 }
 
-// RenewLock a message in the subscription to keep blocking re-processing
-func (c *pubsubClient) RenewLock(message *Message) error {
-	return renewMessageLock(c.client, message)
+// RenewLockContext renews the lock of a message using the specified context
+func (c *settler) RenewLockContext(ctx context.Context, message *Message) error {
+	return renewMessageLock(ctx, c.client, message)
 }
 
-// DestructiveRead a message, removing it from the subscription. The timeout
-// should be specified in seconds.
-func (c *pubsubClient) DestructiveRead(timeout int) (*Message, error) {
-	path := fmt.Sprintf("/%s/subscriptions/%s/messages/head?timeout=%d", c.topic, c.subscription, timeout)
-	return destructiveReadMessage(c.client, path, timeout)
+// DeleteMessage from the queue or subscription
+func (c *settler) DeleteMessage(message *Message) error {
+	return c.DeleteMessageContext(context.Background(), message)
 }
 
-// DeleteMessage from the subscription
-func (c *pubsubClient) DeleteMessage(message *Message) error {
-	return deleteMessage(c.client, message)
+// DeleteMessageContext deletes a message from the queue or subscription
+// using the specified context
+func (c *settler) DeleteMessageContext(ctx context.Context, message *Message) error {
+	return deleteMessage(ctx, c.client, message)
 }
 
 // NewQueueClient creates a new instance of an Azure Service Bus
 // client aimed at queue communication
-func NewQueueClient(cnxString string, queueName string) (Client, error) {
-	cnx, err := ParseConnectionString(cnxString)
+func NewQueueClient(cnxString string, queueName string, opts ...Option) (Client, error) {
+	ns, err := NewNamespace(cnxString, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &queueClient{
-		queueName: queueName,
-		client:    NewHTTPRequestClient(cnx),
-	}, nil
+	return ns.QueueClient(queueName), nil
 }
 
 // NewPubSubClient creates a new instance of an Azure Service Bus
 // client aimed at either sending messages to a topic or receiving
 // messages from a subscription
-func NewPubSubClient(cnxString string, topic string, subscription string) (Client, error) {
-	cnx, err := ParseConnectionString(cnxString)
+func NewPubSubClient(cnxString string, topic string, subscription string, opts ...Option) (Client, error) {
+	ns, err := NewNamespace(cnxString, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.PubSubClient(topic, subscription), nil
+}
+
+// NewQueueSender creates a new instance of an Azure Service Bus
+// sender aimed at sending messages to a queue
+func NewQueueSender(cnxString string, queueName string, opts ...Option) (Sender, error) {
+	ns, err := NewNamespace(cnxString, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.QueueSender(queueName), nil
+}
+
+// NewTopicSender creates a new instance of an Azure Service Bus
+// sender aimed at publishing messages to a topic
+func NewTopicSender(cnxString string, topic string, opts ...Option) (Sender, error) {
+	ns, err := NewNamespace(cnxString, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.TopicSender(topic), nil
+}
+
+// NewQueueReceiver creates a new instance of an Azure Service Bus
+// consumer aimed at receiving and settling messages from a queue
+func NewQueueReceiver(cnxString string, queueName string, opts ...Option) (Consumer, error) {
+	ns, err := NewNamespace(cnxString, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.QueueReceiver(queueName), nil
+}
+
+// NewSubscriptionReceiver creates a new instance of an Azure Service Bus
+// consumer aimed at receiving and settling messages from a subscription
+func NewSubscriptionReceiver(cnxString string, topic string, subscription string, opts ...Option) (Consumer, error) {
+	ns, err := NewNamespace(cnxString, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &pubsubClient{
-		topic:        topic,
-		subscription: subscription,
-		client:       NewHTTPRequestClient(cnx),
-	}, nil
+	return ns.SubscriptionReceiver(topic, subscription), nil
 }
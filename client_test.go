@@ -1,6 +1,17 @@
 package azureservicebus
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestNewQueueClient(t *testing.T) {
 	client, err := NewQueueClient("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey", "test-queue")
@@ -21,3 +32,256 @@ func TestNewPubSubClient(t *testing.T) {
 		t.Errorf("Pubsub client is nil.")
 	}
 }
+
+func TestNewQueueSender(t *testing.T) {
+	sender, err := NewQueueSender("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey", "test-queue")
+	if err != nil {
+		t.Errorf("Could not create queue sender.")
+	}
+	if sender == nil {
+		t.Errorf("Queue sender is nil.")
+	}
+}
+
+func TestNewSubscriptionReceiver(t *testing.T) {
+	receiver, err := NewSubscriptionReceiver("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey", "test-topic", "test-subscription")
+	if err != nil {
+		t.Errorf("Could not create subscription receiver.")
+	}
+	if receiver == nil {
+		t.Errorf("Subscription receiver is nil.")
+	}
+}
+
+func TestSubscriptionReceiverPath(t *testing.T) {
+	var path string
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+
+	receiver := newReceiver(hrc, subscriptionPath("test-topic", "test-subscription"))
+	if _, err := receiver.PeekLockMessage(1); err != nil {
+		t.Errorf("Could not peek lock message: %v", err)
+	}
+	if path != "/test-topic/subscriptions/test-subscription/messages/head" {
+		t.Errorf("Message was not received from the subscription.")
+	}
+}
+
+func newTestHTTPRequestClient(t *testing.T, handler http.HandlerFunc) (*HTTPRequestClient, *httptest.Server) {
+	ts := httptest.NewServer(handler)
+
+	target, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Could not parse test server URL.")
+	}
+
+	return NewHTTPRequestClient(&connectionString{target, "test", "TestSharedAccessKey", "TestSharedAccessKey"}), ts
+}
+
+func TestPeekLockMessageContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+	defer close(release)
+
+	client := newReceiver(hrc, queuePath("test-queue"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err := client.PeekLockMessageContext(ctx, 30)
+	if err == nil {
+		t.Errorf("Cancelled long poll did not return an error.")
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Errorf("Long poll was not cancelled by the context.")
+	}
+}
+
+func TestLongPollOnEmptyQueue(t *testing.T) {
+	var timeouts []string
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		timeouts = append(timeouts, r.URL.Query().Get("timeout"))
+
+		// Answer after the operation timeout, as a poll which waited would
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+	hrc.operationTimeout = 50 * time.Millisecond
+
+	client := newReceiver(hrc, queuePath("test-queue"))
+
+	msg, err := client.PeekLockMessage(1)
+	if msg != nil || err != nil {
+		t.Errorf("Long poll on an empty queue returned %v, %v, expected no message.", msg, err)
+	}
+
+	_, err = client.DestructiveRead(1)
+	if err != ErrNoMessage {
+		t.Errorf("Long poll on an empty queue returned %v, expected ErrNoMessage.", err)
+	}
+
+	if len(timeouts) != 2 || timeouts[0] != "1" || timeouts[1] != "1" {
+		t.Errorf("Long polls were sent with timeouts %v, expected [1 1].", timeouts)
+	}
+}
+
+func TestSendContext(t *testing.T) {
+	var path string
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	client := newSender(hrc, "test-topic")
+
+	err := client.SendContext(context.Background(), &Message{Body: []byte("test-body")})
+	if err != nil {
+		t.Errorf("Could not send message: %v", err)
+	}
+	if path != "/test-topic/messages/" {
+		t.Errorf("Message was not sent to the topic.")
+	}
+}
+
+func TestSendBrokerProperties(t *testing.T) {
+	var header http.Header
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	message := &Message{
+		MessageID:   "test-id",
+		SessionID:   "test-session",
+		ContentType: "application/json",
+		Body:        []byte("{}"),
+	}
+	if err := newSender(hrc, "test-queue").Send(message); err != nil {
+		t.Errorf("Could not send message: %v", err)
+	}
+
+	if header.Get("BrokerProperties") != `{"MessageId":"test-id","SessionId":"test-session"}` {
+		t.Errorf("Message was not sent with broker properties.")
+	}
+	if header.Get("Content-Type") != "application/json" {
+		t.Errorf("Message was not sent with content type.")
+	}
+}
+
+func TestSendMessageTooLarge(t *testing.T) {
+	requests := 0
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	hrc.maxMessageSize = 100
+
+	message := &Message{Body: make([]byte, 90), Properties: Properties{"Customer": "ACME"}}
+	err := newSender(hrc, "test-queue").Send(message)
+
+	var tooLarge *MessageTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Oversized message did not return a MessageTooLargeError.")
+	}
+	if tooLarge.Size != 104 || tooLarge.Limit != 100 {
+		t.Errorf("MessageTooLargeError did not contain size and limit.")
+	}
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("MessageTooLargeError did not match ErrMessageTooLarge.")
+	}
+	if requests != 0 {
+		t.Errorf("Oversized message was uploaded.")
+	}
+}
+
+// testQueue is a minimal queue served over the REST protocol, handing
+// out sent messages with their properties on peek lock
+type testQueue struct {
+	mu       sync.Mutex
+	url      string
+	messages []testQueueMessage
+	deleted  int
+}
+
+type testQueueMessage struct {
+	header http.Header
+	body   []byte
+}
+
+var testQueueSkippedHeaders = map[string]bool{
+	"Accept":          true,
+	"Accept-Encoding": true,
+	"Authorization":   true,
+	"Content-Length":  true,
+	"User-Agent":      true,
+}
+
+func (q *testQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/messages/"):
+		q.messages = append(q.messages, testQueueMessage{header: r.Header.Clone(), body: body})
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/messages/head"):
+		if len(q.messages) == 0 {
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		msg := q.messages[0]
+		q.messages = q.messages[1:]
+
+		for key, values := range msg.header {
+			if !testQueueSkippedHeaders[key] {
+				w.Header()[key] = values
+			}
+		}
+		if w.Header().Get("BrokerProperties") == "" {
+			w.Header().Set("BrokerProperties", "{}")
+		}
+		w.Header().Set("Location", q.url+"/test-queue/messages/1/7da9cfd5-40d5-4bb1-8d64-ec5a52e1c547")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(msg.body)
+	case r.Method == "DELETE":
+		q.deleted++
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func newTestQueueNamespace(t *testing.T, opts ...Option) (*Namespace, *testQueue, *httptest.Server) {
+	queue := &testQueue{}
+	hrc, ts := newTestHTTPRequestClient(t, queue.ServeHTTP)
+	queue.url = ts.URL
+
+	for _, opt := range opts {
+		opt(hrc)
+	}
+
+	return NewNamespaceWithClient(hrc), queue, ts
+}
+
+func newTestQueueClient(t *testing.T, opts ...Option) (Client, *testQueue, *httptest.Server) {
+	ns, queue, ts := newTestQueueNamespace(t, opts...)
+	return ns.QueueClient("test-queue"), queue, ts
+}
@@ -0,0 +1,185 @@
+package azureservicebus
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedContentType is returned when no codec is registered
+// for the content type of a message
+var ErrUnsupportedContentType = errors.New("Unsupported content type")
+
+// Codec marshals values into message bodies and back, identified
+// by the content type it produces
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec encodes bodies as application/json
+	JSONCodec Codec = jsonCodec{}
+	// XMLCodec encodes bodies as application/xml
+	XMLCodec Codec = xmlCodec{}
+	// GobCodec encodes bodies as application/x-gob
+	GobCodec Codec = gobCodec{}
+	// TextCodec encodes strings, byte slices and fmt.Stringer
+	// values as text/plain
+	TextCodec Codec = textCodec{}
+)
+
+var codecs = struct {
+	sync.RWMutex
+	byContentType map[string]Codec
+}{
+	byContentType: map[string]Codec{
+		"application/json":  JSONCodec,
+		"application/xml":   XMLCodec,
+		"text/xml":          XMLCodec,
+		"application/x-gob": GobCodec,
+		"text/plain":        TextCodec,
+	},
+}
+
+// RegisterCodec makes a codec available for decoding messages with
+// its content type, replacing any codec registered for the same type
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	codecs.byContentType[mediaType(codec.ContentType())] = codec
+}
+
+// CodecForContentType returns the codec registered for a content type,
+// ignoring any parameters such as charset
+func CodecForContentType(contentType string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok := codecs.byContentType[mediaType(contentType)]
+	return codec, ok
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mt
+}
+
+// NewMessageFrom creates a new message with the body marshaled
+// from v, and the content type set from the codec
+func NewMessageFrom(v interface{}, codec Codec) (*Message, error) {
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ContentType: codec.ContentType(),
+		Body:        body,
+	}, nil
+}
+
+// Decode unmarshals the body of the message into v, using the codec
+// registered for the content type of the message. Messages without a
+// content type are decoded as JSON.
+func (m *Message) Decode(v interface{}) error {
+	if m.ContentType == "" {
+		return JSONCodec.Unmarshal(m.Body, v)
+	}
+
+	codec, ok := CodecForContentType(m.ContentType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedContentType, m.ContentType)
+	}
+
+	return codec.Unmarshal(m.Body, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string {
+	return "application/xml"
+}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string {
+	return "application/x-gob"
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (textCodec) Marshal(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case string:
+		return []byte(t), nil
+	case []byte:
+		return t, nil
+	case fmt.Stringer:
+		return []byte(t.String()), nil
+	}
+
+	return nil, fmt.Errorf("Could not marshal %T as text", v)
+}
+
+func (textCodec) Unmarshal(data []byte, v interface{}) error {
+	switch t := v.(type) {
+	case *string:
+		*t = string(data)
+		return nil
+	case *[]byte:
+		*t = append((*t)[:0], data...)
+		return nil
+	}
+
+	return fmt.Errorf("Could not unmarshal text into %T", v)
+}
@@ -0,0 +1,59 @@
+package azureservicebus
+
+import (
+	"errors"
+	"testing"
+)
+
+type codecTestValue struct {
+	Name  string
+	Count int
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, XMLCodec, GobCodec} {
+		msg, err := NewMessageFrom(codecTestValue{"test", 3}, codec)
+		if err != nil {
+			t.Errorf("Could not create message with %s codec: %v", codec.ContentType(), err)
+			continue
+		}
+		if msg.ContentType != codec.ContentType() {
+			t.Errorf("Message did not get content type from %s codec.", codec.ContentType())
+		}
+
+		var v codecTestValue
+		if err := msg.Decode(&v); err != nil {
+			t.Errorf("Could not decode message with %s codec: %v", codec.ContentType(), err)
+		}
+		if v.Name != "test" || v.Count != 3 {
+			t.Errorf("Message did not round trip with %s codec.", codec.ContentType())
+		}
+	}
+}
+
+func TestTextCodec(t *testing.T) {
+	msg, err := NewMessageFrom("test-body", TextCodec)
+	if err != nil {
+		t.Errorf("Could not create text message.")
+	}
+
+	msg.ContentType = "text/plain; charset=utf-8"
+	var s string
+	if err := msg.Decode(&s); err != nil || s != "test-body" {
+		t.Errorf("Text message did not round trip.")
+	}
+}
+
+func TestDecodeSelectsCodec(t *testing.T) {
+	var s string
+	msg := &Message{ContentType: "application/x-unknown", Body: []byte("test-body")}
+	if err := msg.Decode(&s); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Errorf("Unknown content type did not return ErrUnsupportedContentType.")
+	}
+
+	var v codecTestValue
+	msg = &Message{Body: []byte(`{"Name":"test"}`)}
+	if err := msg.Decode(&v); err != nil || v.Name != "test" {
+		t.Errorf("Message without content type was not decoded as JSON.")
+	}
+}
@@ -0,0 +1,151 @@
+package azureservicebus
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ContentEncodingProperty is the custom property marking a compressed
+// message body. It is not named Content-Encoding, since net/http and
+// Azure Service Bus interpret that header themselves.
+const ContentEncodingProperty = "ContentEncoding"
+
+// Compression is an algorithm used to compress message bodies
+type Compression string
+
+const (
+	// CompressionGzip compresses bodies with gzip
+	CompressionGzip Compression = "gzip"
+	// CompressionDeflate compresses bodies with deflate
+	CompressionDeflate Compression = "deflate"
+)
+
+// WithCompression compresses message bodies larger than threshold
+// bytes before sending, marking them with the ContentEncoding property.
+// Compression is applied before any interceptor, and received messages
+// are decompressed after all interceptors, regardless of this option.
+// Messages sent with SendBatch are not compressed, since the batch
+// format only holds bodies which are valid UTF-8.
+func WithCompression(compression Compression, threshold int) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.compression = compression
+		hrc.compressionThreshold = threshold
+	}
+}
+
+// decompressionFactor is how many times the maximum message size a
+// body may grow to when decompressed, unless WithMaxDecompressedSize
+// sets a limit
+const decompressionFactor = 4
+
+// WithMaxDecompressedSize limits the size in bytes a received body may
+// decompress to, protecting consumers from decompression bombs. It
+// defaults to four times the maximum message size; raise it when large
+// bodies are both compressed and offloaded by a claim check.
+func WithMaxDecompressedSize(size int) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.maxDecompressedSize = size
+	}
+}
+
+// decompressionLimit returns the maximum size of a decompressed body
+func (hrc *HTTPRequestClient) decompressionLimit() int {
+	if hrc.maxDecompressedSize > 0 {
+		return hrc.maxDecompressedSize
+	}
+	return decompressionFactor * hrc.maxMessageSize
+}
+
+// compressMessage compresses the body of a message larger than
+// the threshold, leaving it untouched if it does not shrink
+func compressMessage(message *Message, compression Compression, threshold int) error {
+	if compression == "" || len(message.Body) <= threshold {
+		return nil
+	}
+	if _, ok := message.Properties.Get(ContentEncodingProperty); ok {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionDeflate:
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		w = fw
+	default:
+		return fmt.Errorf("Unsupported compression %q", compression)
+	}
+
+	if _, err := w.Write(message.Body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if buf.Len() >= len(message.Body) {
+		return nil
+	}
+
+	if message.Properties == nil {
+		message.Properties = make(Properties)
+	}
+	message.Properties[ContentEncodingProperty] = string(compression)
+	message.Body = buf.Bytes()
+	return nil
+}
+
+// decompressMessage decompresses the body of a message marked with
+// the ContentEncoding property, and removes the property. Bodies
+// decompressing to more than limit bytes fail with ErrInvalidMessage.
+func decompressMessage(message *Message, limit int) error {
+	encoding, ok := message.Properties.String(ContentEncodingProperty)
+	if !ok {
+		return nil
+	}
+
+	var r io.ReadCloser
+	switch Compression(encoding) {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(message.Body))
+		if err != nil {
+			return err
+		}
+		r = gr
+	case CompressionDeflate:
+		r = flate.NewReader(bytes.NewReader(message.Body))
+	default:
+		return fmt.Errorf("Unsupported content encoding %q", encoding)
+	}
+	defer r.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > limit {
+		return fmt.Errorf("%w: decompressed body exceeds %d bytes", ErrInvalidMessage, limit)
+	}
+
+	for key := range message.Properties {
+		if strings.EqualFold(key, ContentEncodingProperty) {
+			delete(message.Properties, key)
+		}
+	}
+	if len(message.Properties) == 0 {
+		message.Properties = nil
+	}
+
+	message.Body = body
+	return nil
+}
@@ -0,0 +1,127 @@
+package azureservicebus
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{CompressionGzip, CompressionDeflate} {
+		client, queue, ts := newTestQueueClient(t, WithCompression(compression, 100))
+
+		body := strings.Repeat(`{"name":"test"}`, 100)
+		if err := client.Send(&Message{Body: []byte(body)}); err != nil {
+			t.Fatalf("Could not send %s compressed message: %v", compression, err)
+		}
+		if len(queue.messages[0].body) >= len(body) {
+			t.Errorf("Body was not %s compressed.", compression)
+		}
+		if queue.messages[0].header.Get(ContentEncodingProperty) != `"`+string(compression)+`"` {
+			t.Errorf("Compressed message was not marked with %s.", ContentEncodingProperty)
+		}
+
+		msg, err := client.PeekLockMessage(1)
+		if err != nil {
+			t.Fatalf("Could not receive %s compressed message: %v", compression, err)
+		}
+		if string(msg.Body) != body {
+			t.Errorf("Received message was not %s decompressed.", compression)
+		}
+		if _, ok := msg.Properties.Get(ContentEncodingProperty); ok {
+			t.Errorf("Decompressed message kept %s property.", ContentEncodingProperty)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestCompressionBelowThreshold(t *testing.T) {
+	client, queue, ts := newTestQueueClient(t, WithCompression(CompressionGzip, 100))
+	defer ts.Close()
+
+	if err := client.Send(&Message{Body: []byte("small")}); err != nil {
+		t.Fatalf("Could not send message: %v", err)
+	}
+	if string(queue.messages[0].body) != "small" {
+		t.Errorf("Body below the threshold was compressed.")
+	}
+}
+
+func TestCompressionWithClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimcheck")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory.")
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := NewFileBlobStore(dir)
+	client, _, ts := newTestQueueClient(t, WithClaimCheck(store, 100), WithCompression(CompressionGzip, 100))
+	defer ts.Close()
+
+	body := strings.Repeat("abcdefghijklmnopqrstuvwxyz", 1000)
+	if err := client.Send(&Message{Body: []byte(body)}); err != nil {
+		t.Fatalf("Could not send message: %v", err)
+	}
+
+	msg, err := client.PeekLockMessage(1)
+	if err != nil {
+		t.Fatalf("Could not receive message: %v", err)
+	}
+	if string(msg.Body) != body {
+		t.Errorf("Compressed and claim checked message did not round trip.")
+	}
+}
+
+func TestResponseToMessageDecompresses(t *testing.T) {
+	message := &Message{Body: []byte(strings.Repeat("test-body", 100))}
+	if err := compressMessage(message, CompressionGzip, 0); err != nil {
+		t.Fatalf("Could not compress message: %v", err)
+	}
+
+	resp := &http.Response{
+		Header: http.Header{
+			"Brokerproperties": {"{}"},
+			"Contentencoding":  {`"gzip"`},
+		},
+		Body: ioutil.NopCloser(bytes.NewReader(message.Body)),
+	}
+
+	msg, err := ResponseToMessage(resp)
+	if err != nil {
+		t.Fatalf("Could not read message from response: %v", err)
+	}
+	if string(msg.Body) != strings.Repeat("test-body", 100) {
+		t.Errorf("ResponseToMessage did not decompress the body.")
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	body := bytes.Repeat([]byte{0}, 2*1024*1024)
+
+	client, _, ts := newTestQueueClient(t, WithCompression(CompressionGzip, 100))
+	defer ts.Close()
+
+	if err := client.Send(&Message{Body: body}); err != nil {
+		t.Fatalf("Could not send message: %v", err)
+	}
+	if _, err := client.PeekLockMessage(1); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Body decompressing beyond the limit returned %v, expected ErrInvalidMessage.", err)
+	}
+
+	client, _, ts = newTestQueueClient(t, WithCompression(CompressionGzip, 100), WithMaxDecompressedSize(len(body)))
+	defer ts.Close()
+
+	client.Send(&Message{Body: body})
+	msg, err := client.PeekLockMessage(1)
+	if err != nil {
+		t.Fatalf("Could not receive message within the raised limit: %v", err)
+	}
+	if !bytes.Equal(msg.Body, body) {
+		t.Errorf("Message within the raised limit was not decompressed.")
+	}
+}
@@ -0,0 +1,207 @@
+package azureservicebus
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// EncryptionKeyIDProperty is the custom property holding the id
+	// of the key an encrypted message body was encrypted with
+	EncryptionKeyIDProperty = "EncryptionKeyId"
+	// EncryptionAuthenticatedProperty is the custom property listing
+	// the custom properties authenticated along with the body
+	EncryptionAuthenticatedProperty = "EncryptionAuthenticated"
+)
+
+// ErrDecryptionFailed is returned when an encrypted message could not
+// be decrypted, because the key is unknown or the body or authenticated
+// properties have been tampered with
+var ErrDecryptionFailed = errors.New("Could not decrypt message")
+
+// KeyProvider supplies AES keys (16, 24 or 32 bytes) for encryption.
+// CurrentKey is used for outgoing messages; Key looks up the key of
+// an incoming message by id, so that old keys remain readable while
+// rotating to a new one.
+type KeyProvider interface {
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider with a fixed set of keys
+type StaticKeyProvider struct {
+	CurrentID string
+	Keys      map[string][]byte
+}
+
+// CurrentKey returns the key with id CurrentID
+func (p *StaticKeyProvider) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := p.Key(ctx, p.CurrentID)
+	return p.CurrentID, key, err
+}
+
+// Key returns the key with the specified id
+func (p *StaticKeyProvider) Key(ctx context.Context, id string) ([]byte, error) {
+	key, ok := p.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("Unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+// Encryption is an Interceptor encrypting message bodies with AES-GCM.
+// The custom properties of an outgoing message are authenticated along
+// with the body, so changing them makes decryption fail. Received
+// messages without an EncryptionKeyId property are left untouched.
+type Encryption struct {
+	keys KeyProvider
+}
+
+// NewEncryption creates an Encryption using keys from the provider
+func NewEncryption(keys KeyProvider) *Encryption {
+	return &Encryption{keys: keys}
+}
+
+// WithEncryption encrypts message bodies using keys from the provider
+func WithEncryption(keys KeyProvider) Option {
+	return WithInterceptor(NewEncryption(keys))
+}
+
+// OutgoingMessage encrypts the body of the message
+func (e *Encryption) OutgoingMessage(ctx context.Context, message *Message) error {
+	id, key, err := e.keys.CurrentKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	authenticated := propertyNames(message.Properties)
+
+	ad, err := additionalData(message.Properties, id, authenticated)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	if message.Properties == nil {
+		message.Properties = make(Properties)
+	}
+	message.Properties[EncryptionKeyIDProperty] = id
+	message.Properties[EncryptionAuthenticatedProperty] = authenticated
+	message.Body = aead.Seal(nonce, nonce, message.Body, ad)
+	return nil
+}
+
+// IncomingMessage decrypts the body of an encrypted message and
+// verifies its authenticated properties
+func (e *Encryption) IncomingMessage(ctx context.Context, message *Message) error {
+	id, ok := message.Properties.String(EncryptionKeyIDProperty)
+	if !ok {
+		return nil
+	}
+	authenticated, _ := message.Properties.String(EncryptionAuthenticatedProperty)
+
+	key, err := e.keys.Key(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	ad, err := additionalData(message.Properties, id, authenticated)
+	if err != nil {
+		return fmt.Errorf("%w: authenticated %v", ErrDecryptionFailed, err)
+	}
+
+	if len(message.Body) < aead.NonceSize() {
+		return fmt.Errorf("%w: body is too short", ErrDecryptionFailed)
+	}
+	nonce, ciphertext := message.Body[:aead.NonceSize()], message.Body[aead.NonceSize():]
+
+	body, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+
+	for name := range message.Properties {
+		if strings.EqualFold(name, EncryptionKeyIDProperty) || strings.EqualFold(name, EncryptionAuthenticatedProperty) {
+			delete(message.Properties, name)
+		}
+	}
+	message.Body = body
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData serializes the key id, the list of authenticated
+// properties and their encoded values
+func additionalData(props Properties, keyID string, authenticated string) ([]byte, error) {
+	ad := appendLengthPrefixed(nil, keyID)
+	return appendProperties(ad, props, authenticated)
+}
+
+// appendProperties appends a comma-separated list of property names
+// and the encoded values of those properties, each length-prefixed
+func appendProperties(b []byte, props Properties, names string) ([]byte, error) {
+	b = appendLengthPrefixed(b, names)
+	if names == "" {
+		return b, nil
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		value, ok := props.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("property %s is missing", name)
+		}
+
+		encoded, err := encodePropertyValue(value)
+		if err != nil {
+			return nil, err
+		}
+		b = appendLengthPrefixed(b, encoded)
+	}
+
+	return b, nil
+}
+
+func appendLengthPrefixed(b []byte, s string) []byte {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(s)))
+	return append(append(b, n[:]...), s...)
+}
+
+// propertyNames returns the lowercased, sorted and comma-separated
+// names of the properties
+func propertyNames(props Properties) string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
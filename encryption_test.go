@@ -0,0 +1,64 @@
+package azureservicebus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func newTestKeyProvider() *StaticKeyProvider {
+	return &StaticKeyProvider{
+		CurrentID: "key-1",
+		Keys: map[string][]byte{
+			"key-1": bytes.Repeat([]byte{1}, 32),
+			"key-2": bytes.Repeat([]byte{2}, 32),
+		},
+	}
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	keys := newTestKeyProvider()
+	client, queue, ts := newTestQueueClient(t, WithEncryption(keys))
+	defer ts.Close()
+
+	if err := client.Send(&Message{Body: []byte("personal data"), Properties: Properties{"Customer": "ACME"}}); err != nil {
+		t.Fatalf("Could not send encrypted message: %v", err)
+	}
+	if bytes.Contains(queue.messages[0].body, []byte("personal data")) {
+		t.Errorf("Body was sent in plain text.")
+	}
+
+	keys.CurrentID = "key-2"
+
+	msg, err := client.PeekLockMessage(1)
+	if err != nil {
+		t.Fatalf("Could not decrypt message after key rotation: %v", err)
+	}
+	if string(msg.Body) != "personal data" {
+		t.Errorf("Decrypted body did not match.")
+	}
+	if _, ok := msg.Properties.Get(EncryptionKeyIDProperty); ok {
+		t.Errorf("Decrypted message kept %s property.", EncryptionKeyIDProperty)
+	}
+	if s, _ := msg.Properties.String("Customer"); s != "ACME" {
+		t.Errorf("Custom property was not kept.")
+	}
+}
+
+func TestEncryptionDetectsTampering(t *testing.T) {
+	client, queue, ts := newTestQueueClient(t, WithEncryption(newTestKeyProvider()))
+	defer ts.Close()
+
+	if err := client.Send(&Message{Body: []byte("personal data"), Properties: Properties{"Amount": int64(10)}}); err != nil {
+		t.Fatalf("Could not send encrypted message: %v", err)
+	}
+	queue.messages[0].header.Set("Amount", "1000")
+
+	msg, err := client.PeekLockMessage(1)
+	if !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("Tampered property did not fail decryption.")
+	}
+	if msg == nil {
+		t.Errorf("Message was not returned with the decryption error.")
+	}
+}
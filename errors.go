@@ -0,0 +1,175 @@
+package azureservicebus
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoMessage is returned when no message was available
+	// before the receive timeout passed
+	ErrNoMessage = errors.New("No message available")
+	// ErrLockLost is returned when the lock of a message has expired
+	// or the message has already been settled
+	ErrLockLost = errors.New("Message lock lost")
+	// ErrUnauthorized is returned when the credentials were rejected
+	ErrUnauthorized = errors.New("Unauthorized")
+	// ErrQuotaExceeded is returned when an entity or namespace quota
+	// has been exceeded
+	ErrQuotaExceeded = errors.New("Quota exceeded")
+	// ErrEntityNotFound is returned when the queue, topic or
+	// subscription does not exist
+	ErrEntityNotFound = errors.New("Entity not found")
+	// ErrThrottled is returned when the request was throttled or the
+	// service was temporarily unavailable, see Error.RetryAfter
+	ErrThrottled = errors.New("Request throttled")
+	// ErrMessageTooLarge is returned when a message exceeds the
+	// maximum message size of the entity
+	ErrMessageTooLarge = errors.New("Message too large")
+	// ErrInvalidMessage is returned when a message is rejected
+	// before sending, for example due to invalid broker properties
+	ErrInvalidMessage = errors.New("Invalid message")
+)
+
+const maxErrorBodySize = 64 * 1024
+
+// Error is returned when Azure Service Bus responds to an operation
+// with an unexpected status code. It can be matched against the
+// package sentinels using errors.Is.
+type Error struct {
+	StatusCode int
+	Operation  string
+	EntityPath string
+	RetryAfter time.Duration
+	Code       string
+	Detail     string
+
+	lockOperation bool
+}
+
+// MessageTooLargeError is returned before sending when the serialized
+// size of a message exceeds the maximum message size of the tier. It
+// matches ErrMessageTooLarge using errors.Is.
+type MessageTooLargeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("Message of %d bytes exceeds the maximum message size of %d bytes", e.Size, e.Limit)
+}
+
+// Is reports whether the target is ErrMessageTooLarge
+func (e *MessageTooLargeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
+
+type errorBody struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Detail  string   `xml:"Detail"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("Could not %s. Server returned error %d: %s", e.Operation, e.StatusCode, e.Detail)
+	}
+
+	return fmt.Sprintf("Could not %s. Server returned error %d", e.Operation, e.StatusCode)
+}
+
+// Is reports whether the error matches one of the package sentinels
+func (e *Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrQuotaExceeded
+	case http.StatusNotFound:
+		if e.lockOperation {
+			return target == ErrLockLost
+		}
+		return target == ErrEntityNotFound
+	case http.StatusGone:
+		return target == ErrLockLost
+	case http.StatusRequestEntityTooLarge:
+		return target == ErrMessageTooLarge
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return target == ErrThrottled
+	}
+
+	return false
+}
+
+// newError creates an Error from an unexpected response,
+// consuming the response body
+func newError(operation string, entityPath string, resp *http.Response) *Error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Operation:  operation,
+		EntityPath: entityPath,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil || len(data) == 0 {
+		return e
+	}
+
+	var body errorBody
+	if err := xml.Unmarshal(data, &body); err != nil {
+		return e
+	}
+
+	e.Code = strings.TrimSpace(body.Code)
+	e.Detail = strings.TrimSpace(body.Detail)
+	return e
+}
+
+// newLockError creates an Error for an operation on the lock
+// of a message, where 404 means the lock has been lost
+func newLockError(operation string, message *Message, resp *http.Response) *Error {
+	e := newError(operation, entityPathFromLocation(message.Location), resp)
+	e.lockOperation = true
+	return e
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+func entityPathFromLocation(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return ""
+	}
+
+	path := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(path, "/messages/"); i >= 0 {
+		return path[:i]
+	}
+
+	return path
+}
@@ -0,0 +1,75 @@
+package azureservicebus
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestErrorFromStatusCode(t *testing.T) {
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("<Error><Code>503</Code><Detail>The server is busy.</Detail></Error>"))
+	})
+	defer ts.Close()
+
+	err := newSender(hrc, "test-queue").Send(&Message{Body: []byte("test-body")})
+	if !errors.Is(err, ErrThrottled) {
+		t.Errorf("Throttled request did not match ErrThrottled.")
+	}
+
+	var sbErr *Error
+	if !errors.As(err, &sbErr) {
+		t.Fatalf("Error is not an *Error.")
+	}
+	if sbErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Error did not contain status code.")
+	}
+	if sbErr.EntityPath != "test-queue" {
+		t.Errorf("Error did not contain entity path.")
+	}
+	if sbErr.RetryAfter != 10*time.Second {
+		t.Errorf("Error did not contain Retry-After.")
+	}
+	if sbErr.Detail != "The server is busy." {
+		t.Errorf("Error did not contain detail from response body.")
+	}
+}
+
+func TestLockErrorNotFoundIsLockLost(t *testing.T) {
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer ts.Close()
+
+	message := &Message{Location: ts.URL + "/test-queue/messages/1/7da9cfd5-40d5-4bb1-8d64-ec5a52e1c547"}
+	err := newReceiver(hrc, "test-queue").DeleteMessage(message)
+	if !errors.Is(err, ErrLockLost) {
+		t.Errorf("Missing lock did not match ErrLockLost.")
+	}
+	if errors.Is(err, ErrEntityNotFound) {
+		t.Errorf("Missing lock matched ErrEntityNotFound.")
+	}
+
+	var sbErr *Error
+	if errors.As(err, &sbErr) && sbErr.EntityPath != "test-queue" {
+		t.Errorf("Error did not contain entity path from message location.")
+	}
+}
+
+func TestDestructiveReadNoMessage(t *testing.T) {
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+
+	msg, err := newReceiver(hrc, "test-queue").DestructiveRead(1)
+	if err != ErrNoMessage {
+		t.Errorf("Empty queue did not return ErrNoMessage.")
+	}
+	if msg != nil {
+		t.Errorf("Empty queue returned a message.")
+	}
+}
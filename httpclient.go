@@ -7,31 +7,72 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 )
 
-const azureServiceBusAPIVersion = "2016-07"
+const (
+	azureServiceBusAPIVersion = "2016-07"
+	defaultOperationTimeout   = 30 * time.Second
+	defaultMaxMessageSize     = 256 * 1024
+	tokenLifetime             = 300 * time.Second
+	tokenRenewalMargin        = 60 * time.Second
+)
 
+// HTTPRequestClient executes requests against an Azure Service Bus
+// namespace. It is safe for concurrent use, and is meant to be shared
+// between all clients of the same namespace.
 type HTTPRequestClient struct {
 	client           *http.Client
 	connectionString *connectionString
+	operationTimeout time.Duration
+	apiVersion       string
+	logger           Logger
+	userAgent        string
+	maxMessageSize   int
+
+	messageIDGenerator MessageIDGenerator
+	interceptors       []Interceptor
+
+	compression          Compression
+	compressionThreshold int
+	maxDecompressedSize  int
+
+	retryPolicy RetryPolicy
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
 }
 
-func NewHTTPRequestClient(cnx *connectionString) *HTTPRequestClient {
-	return &HTTPRequestClient{
+// NewHTTPRequestClient creates a new HTTPRequestClient for the
+// namespace of the connection string, configured by the options
+func NewHTTPRequestClient(cnx *connectionString, opts ...Option) *HTTPRequestClient {
+	hrc := &HTTPRequestClient{
 		client:           &http.Client{},
 		connectionString: cnx,
+		operationTimeout: defaultOperationTimeout,
+		apiVersion:       azureServiceBusAPIVersion,
+		logger:           nopLogger{},
+		maxMessageSize:   defaultMaxMessageSize,
+	}
+
+	for _, opt := range opts {
+		opt(hrc)
 	}
+
+	return hrc
 }
 
 // NewRequestURL creates an Azure Service Bus URL (with versioning)
-// from a the specified connection string and action path
+// from a the specified connection string and action path, keeping
+// any query parameters of the path
 func (hrc *HTTPRequestClient) NewRequestURL(path string) (*url.URL, error) {
 	query := hrc.connectionString.url.Query()
-	query.Set("api-version", azureServiceBusAPIVersion)
 
 	target := fmt.Sprintf("%s%s", hrc.connectionString.url.String(), path)
 	u, err := url.Parse(target)
@@ -39,10 +80,22 @@ func (hrc *HTTPRequestClient) NewRequestURL(path string) (*url.URL, error) {
 		return nil, err
 	}
 
+	for key, values := range u.Query() {
+		query[key] = values
+	}
+	query.Set("api-version", hrc.apiVersion)
+
 	u.RawQuery = query.Encode()
 	return u, nil
 }
 
+// pollTimeout returns the timeout of a request long polling for
+// timeout seconds, leaving the server the operation timeout to
+// answer once the poll has ended
+func (hrc *HTTPRequestClient) pollTimeout(timeout int) time.Duration {
+	return time.Duration(timeout)*time.Second + hrc.operationTimeout
+}
+
 // NewRequest creates a new http.Request instance with the correct
 // headers set for communication with an Azure Service Bus
 func (hrc *HTTPRequestClient) NewRequest(url *url.URL, method string, body []byte) (*http.Request, error) {
@@ -52,7 +105,10 @@ func (hrc *HTTPRequestClient) NewRequest(url *url.URL, method string, body []byt
 	}
 
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", makeAuthorizationHeader(hrc.connectionString))
+	req.Header.Set("Authorization", hrc.authorizationHeader())
+	if hrc.userAgent != "" {
+		req.Header.Set("User-Agent", hrc.userAgent)
+	}
 
 	return req, nil
 }
@@ -60,25 +116,96 @@ func (hrc *HTTPRequestClient) NewRequest(url *url.URL, method string, body []byt
 // Execute is an abstraction for actually making a HTTP request
 // to the Azure Service Bus
 func (hrc *HTTPRequestClient) Execute(req *http.Request) (*http.Response, error) {
-	return hrc.ExecuteWithTimeout(req, time.Second*30)
+	return hrc.ExecuteContext(context.Background(), req)
 }
 
 // ExecuteWithTimeout is an abstraction for actually making a HTTP request
 // to the Azure Service Bus, using a timeout
 func (hrc *HTTPRequestClient) ExecuteWithTimeout(req *http.Request, timeout time.Duration) (*http.Response, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	return hrc.ExecuteWithTimeoutContext(context.Background(), req, timeout)
+}
+
+// ExecuteContext is an abstraction for actually making a HTTP request
+// to the Azure Service Bus, bound to the specified context
+func (hrc *HTTPRequestClient) ExecuteContext(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return hrc.ExecuteWithTimeoutContext(ctx, req, hrc.operationTimeout)
+}
 
+// ExecuteWithTimeoutContext is an abstraction for actually making a HTTP
+// request to the Azure Service Bus, bound to the specified context and
+// using a timeout. The timeout covers reading the response body, which
+// must be closed by the caller. Each attempt made by the retry policy
+// gets the full timeout.
+func (hrc *HTTPRequestClient) ExecuteWithTimeoutContext(ctx context.Context, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := hrc.execute(ctx, req, timeout)
+
+		backoff, ok := hrc.retryPolicy.backoff(ctx, attempt, resp, err)
+		if !ok || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		hrc.logger.Printf("azureservicebus: retrying %s %s in %s", req.Method, req.URL.Path, backoff)
+		if err := retry(ctx, req, resp, backoff); err != nil {
+			return nil, err
+		}
+		// The token may have been renewed while backing off
+		if req.Header.Get("Authorization") != "" {
+			req.Header.Set("Authorization", hrc.authorizationHeader())
+		}
+	}
+}
+
+func (hrc *HTTPRequestClient) execute(ctx context.Context, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	started := time.Now()
 	r, err := hrc.client.Do(req.WithContext(ctx))
 	if err != nil {
+		cancel()
+		hrc.logger.Printf("azureservicebus: %s %s failed after %s: %v", req.Method, req.URL.Path, time.Since(started), err)
 		return nil, err
 	}
 
+	hrc.logger.Printf("azureservicebus: %s %s returned %d after %s", req.Method, req.URL.Path, r.StatusCode, time.Since(started))
+
+	r.Body = &cancelOnClose{ReadCloser: r.Body, cancel: cancel}
 	return r, nil
 }
 
+// cancelOnClose releases the request context once the response
+// body has been consumed, instead of when the request returns
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// authorizationHeader returns a cached shared access signature,
+// creating a new one when the cached signature is about to expire
+func (hrc *HTTPRequestClient) authorizationHeader() string {
+	hrc.mu.Lock()
+	defer hrc.mu.Unlock()
+
+	if hrc.token == "" || time.Now().Add(tokenRenewalMargin).After(hrc.tokenExpiry) {
+		hrc.tokenExpiry = time.Now().Add(tokenLifetime).Round(time.Second)
+		hrc.token = signAuthorizationHeader(hrc.connectionString, hrc.tokenExpiry)
+	}
+
+	return hrc.token
+}
+
 func makeAuthorizationHeader(cnx *connectionString) string {
-	ticks := time.Now().Add(300 * time.Second).Round(time.Second).Unix()
+	return signAuthorizationHeader(cnx, time.Now().Add(tokenLifetime).Round(time.Second))
+}
+
+func signAuthorizationHeader(cnx *connectionString, expiry time.Time) string {
+	ticks := expiry.Unix()
 	expires := strconv.Itoa(int(ticks))
 
 	uri := url.QueryEscape(cnx.url.String())
@@ -3,7 +3,9 @@ package azureservicebus
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func Test_HTTPRequestClient_NewRequestURL(t *testing.T) {
@@ -38,6 +40,29 @@ func Test_HTTPRequestClient_NewRequestURL(t *testing.T) {
 	}
 }
 
+func Test_HTTPRequestClient_NewRequestURLWithQuery(t *testing.T) {
+	cnx, err := ParseConnectionString("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey")
+	if err != nil {
+		t.Errorf("Connectionstring could not be parsed.")
+	}
+
+	c := NewHTTPRequestClient(cnx)
+	url, err := c.NewRequestURL("/test/messages/head?timeout=5")
+	if err != nil {
+		t.Errorf("Could not create request URL.")
+	}
+
+	if url.Path != "/test/messages/head" {
+		t.Errorf("Request URL did not use specified path.")
+	}
+	if url.Query().Get("timeout") != "5" {
+		t.Errorf("Request URL dropped the query of the path.")
+	}
+	if url.Query().Get("api-version") == "" {
+		t.Errorf("Request URL does not contain Azure Service Bus API version.")
+	}
+}
+
 func Test_HTTPRequestClient_NewRequestWithEmptyBody(t *testing.T) {
 	cnx, err := ParseConnectionString("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey")
 	if err != nil {
@@ -102,3 +127,75 @@ func Test_HTTPRequestClient_NewRequestWithBody(t *testing.T) {
 		t.Errorf("Request did not contain correct body data.")
 	}
 }
+
+func Test_HTTPRequestClient_AuthorizationHeaderIsCached(t *testing.T) {
+	cnx, err := ParseConnectionString("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey")
+	if err != nil {
+		t.Errorf("Connectionstring could not be parsed.")
+	}
+
+	c := NewHTTPRequestClient(cnx)
+	first := c.authorizationHeader()
+	if first == "" {
+		t.Errorf("Authorization header is empty.")
+	}
+	if c.authorizationHeader() != first {
+		t.Errorf("Authorization header was not reused while still valid.")
+	}
+
+	c.tokenExpiry = time.Now()
+	if c.authorizationHeader() == "" || c.tokenExpiry.Before(time.Now()) {
+		t.Errorf("Authorization header was not renewed after expiry.")
+	}
+}
+
+func Test_HTTPRequestClient_Options(t *testing.T) {
+	cnx, err := ParseConnectionString("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey")
+	if err != nil {
+		t.Errorf("Connectionstring could not be parsed.")
+	}
+
+	httpClient := &http.Client{}
+	c := NewHTTPRequestClient(cnx,
+		WithHTTPClient(httpClient),
+		WithOperationTimeout(5*time.Second),
+		WithAPIVersion("2017-04"),
+		WithUserAgent("test-agent/1.0"))
+
+	if c.client != httpClient {
+		t.Errorf("Client did not use specified http.Client.")
+	}
+	if c.operationTimeout != 5*time.Second {
+		t.Errorf("Client did not use specified operation timeout.")
+	}
+
+	url, err := c.NewRequestURL("/test")
+	if err != nil {
+		t.Errorf("Could not create request URL.")
+	}
+	if url.Query().Get("api-version") != "2017-04" {
+		t.Errorf("Request URL did not use specified API version.")
+	}
+
+	req, err := c.NewRequest(url, "POST", nil)
+	if err != nil {
+		t.Errorf("Could not create new request.")
+	}
+	if req.Header.Get("User-Agent") != "test-agent/1.0" {
+		t.Errorf("Request did not use specified User-Agent header.")
+	}
+}
+
+func Test_HTTPRequestClient_WithTier(t *testing.T) {
+	cnx, err := ParseConnectionString("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey")
+	if err != nil {
+		t.Errorf("Connectionstring could not be parsed.")
+	}
+
+	if c := NewHTTPRequestClient(cnx); c.maxMessageSize != 256*1024 {
+		t.Errorf("Client did not default to the Standard tier message size.")
+	}
+	if c := NewHTTPRequestClient(cnx, WithTier(TierPremium)); c.maxMessageSize != 1024*1024 {
+		t.Errorf("Client did not use the Premium tier message size.")
+	}
+}
@@ -0,0 +1,121 @@
+package azureservicebus
+
+import (
+	"context"
+	"time"
+)
+
+// Interceptor transforms messages on their way to and from Azure
+// Service Bus. OutgoingMessage is called with a copy of every message
+// before it is validated and sent, and may replace its body and
+// properties. IncomingMessage is called with every received message;
+// when it fails, the receive returns the message together with the
+// error, so that it can still be settled.
+//
+// Interceptors run in the order they were added when sending, and in
+// reverse order when receiving.
+type Interceptor interface {
+	OutgoingMessage(ctx context.Context, message *Message) error
+	IncomingMessage(ctx context.Context, message *Message) error
+}
+
+// DeleteInterceptor is implemented by interceptors which need to know
+// when a message has been removed from its entity, either by
+// DeleteMessage or by DestructiveRead
+type DeleteInterceptor interface {
+	MessageDeleted(ctx context.Context, message *Message) error
+}
+
+// SendFailedInterceptor is implemented by interceptors which need to
+// undo the effect of OutgoingMessage when a message was not accepted by
+// the service, such as releasing resources it allocated. It is called
+// with the transformed message, and not when the outcome is unknown
+// because the request failed without a response.
+type SendFailedInterceptor interface {
+	SendFailed(ctx context.Context, message *Message)
+}
+
+// WithInterceptor adds an interceptor to the message path
+func WithInterceptor(interceptor Interceptor) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.interceptors = append(hrc.interceptors, interceptor)
+	}
+}
+
+// clone copies a message, including its custom properties, so that
+// interceptors can transform it without touching the caller's message
+func (m *Message) clone() *Message {
+	c := *m
+	if m.Properties != nil {
+		c.Properties = make(Properties, len(m.Properties))
+		for key, value := range m.Properties {
+			c.Properties[key] = value
+		}
+	}
+	return &c
+}
+
+// interceptOutgoing returns the message to send, transformed by the
+// interceptors of the client and, when compress is set, compressed
+func interceptOutgoing(ctx context.Context, client *HTTPRequestClient, message *Message, compress bool) (*Message, error) {
+	if len(client.interceptors) == 0 && (!compress || client.compression == "") {
+		return message, nil
+	}
+
+	outgoing := message.clone()
+	if compress {
+		if err := compressMessage(outgoing, client.compression, client.compressionThreshold); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, interceptor := range client.interceptors {
+		if err := interceptor.OutgoingMessage(ctx, outgoing); err != nil {
+			sendFailed(client.interceptors[:i], outgoing, client.operationTimeout)
+			return nil, err
+		}
+	}
+	return outgoing, nil
+}
+
+// interceptSendFailed tells the interceptors of the client
+// that the service did not accept a message
+func interceptSendFailed(client *HTTPRequestClient, message *Message) {
+	sendFailed(client.interceptors, message, client.operationTimeout)
+}
+
+// sendFailed calls the interceptors in reverse order, with a context of
+// its own since the context of the send may be what made it fail
+func sendFailed(interceptors []Interceptor, message *Message, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if f, ok := interceptors[i].(SendFailedInterceptor); ok {
+			f.SendFailed(ctx, message)
+		}
+	}
+}
+
+// interceptIncoming transforms a received message by the interceptors
+// of the client, and decompresses it
+func interceptIncoming(ctx context.Context, client *HTTPRequestClient, message *Message) error {
+	for i := len(client.interceptors) - 1; i >= 0; i-- {
+		if err := client.interceptors[i].IncomingMessage(ctx, message); err != nil {
+			return err
+		}
+	}
+
+	return decompressMessage(message, client.decompressionLimit())
+}
+
+func interceptDeleted(ctx context.Context, client *HTTPRequestClient, message *Message) error {
+	for _, interceptor := range client.interceptors {
+		if d, ok := interceptor.(DeleteInterceptor); ok {
+			if err := d.MessageDeleted(ctx, message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
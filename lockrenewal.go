@@ -0,0 +1,141 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRenewalDuration = 5 * time.Minute
+	lockRenewalRetryDelay     = time.Second
+)
+
+// LockRenewerOption configures a LockRenewer
+type LockRenewerOption func(*LockRenewer)
+
+// WithMaxRenewalDuration sets how long the lock of a message is
+// renewed at most, after which it is left to expire
+func WithMaxRenewalDuration(maxDuration time.Duration) LockRenewerOption {
+	return func(r *LockRenewer) {
+		r.maxDuration = maxDuration
+	}
+}
+
+// WithRenewalErrorHandler sets a function called with every
+// error from renewing a lock
+func WithRenewalErrorHandler(onError func(message *Message, err error)) LockRenewerOption {
+	return func(r *LockRenewer) {
+		r.onError = onError
+	}
+}
+
+// LockRenewer keeps renewing the lock of a peek-locked message while
+// it is being handled. Renewals are scheduled from LockedUntilUtc,
+// when two thirds of the remaining lock duration have passed.
+type LockRenewer struct {
+	settler     Settler
+	maxDuration time.Duration
+	onError     func(message *Message, err error)
+}
+
+// NewLockRenewer creates a LockRenewer renewing locks through the settler
+func NewLockRenewer(settler Settler, opts ...LockRenewerOption) *LockRenewer {
+	r := &LockRenewer{
+		settler:     settler,
+		maxDuration: defaultMaxRenewalDuration,
+		onError:     func(message *Message, err error) {},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Renew starts renewing the lock of the message in the background and
+// returns a context for handling it, which is cancelled when the lock
+// is lost. The returned function stops renewing and must be called
+// when the message has been handled.
+func (r *LockRenewer) Renew(ctx context.Context, message *Message) (context.Context, context.CancelFunc) {
+	handleCtx, cancel := context.WithCancel(ctx)
+
+	lockedUntil := message.LockedUntilUtc.Time
+	if !lockedUntil.After(time.Now()) {
+		return handleCtx, cancel
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.renew(handleCtx, cancel, stop, message, lockedUntil)
+	}()
+
+	var once sync.Once
+	return handleCtx, func() {
+		once.Do(func() {
+			close(stop)
+			wg.Wait()
+			cancel()
+		})
+	}
+}
+
+func (r *LockRenewer) renew(ctx context.Context, lockLost context.CancelFunc, stop <-chan struct{}, message *Message, lockedUntil time.Time) {
+	start := time.Now()
+	lockDuration := lockedUntil.Sub(start)
+	deadline := start.Add(r.maxDuration)
+
+	for {
+		wait := time.Until(lockedUntil) * 2 / 3
+		if wait < 0 {
+			wait = 0
+		}
+
+		renewAt := time.Now().Add(wait)
+		if renewAt.After(deadline) {
+			return
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		renewedAt := time.Now()
+		err := r.settler.RenewLockContext(ctx, message)
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case err == nil:
+			lockedUntil = renewedAt.Add(lockDuration)
+		case errors.Is(err, ErrLockLost):
+			r.onError(message, err)
+			lockLost()
+			return
+		default:
+			r.onError(message, err)
+			if time.Now().Add(lockRenewalRetryDelay).After(lockedUntil) {
+				lockLost()
+				return
+			}
+
+			select {
+			case <-time.After(lockRenewalRetryDelay):
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
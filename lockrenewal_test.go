@@ -0,0 +1,99 @@
+package azureservicebus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func lockedMessage(lockDuration time.Duration) *Message {
+	return &Message{LockedUntilUtc: dateTime{time.Now().Add(lockDuration)}}
+}
+
+func (c *memoryConsumer) renewals() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.renewed
+}
+
+func TestLockRenewerRenewsBeforeExpiry(t *testing.T) {
+	consumer := newMemoryConsumer()
+	renewer := NewLockRenewer(consumer)
+
+	ctx, stop := renewer.Renew(context.Background(), lockedMessage(150*time.Millisecond))
+	time.Sleep(400 * time.Millisecond)
+	stop()
+
+	if consumer.renewals() < 2 {
+		t.Errorf("Lock was renewed %d times, expected at least 2.", consumer.renewals())
+	}
+	if ctx.Err() == nil {
+		t.Errorf("Handler context was not cancelled after stopping renewal.")
+	}
+
+	renewed := consumer.renewals()
+	time.Sleep(200 * time.Millisecond)
+	if consumer.renewals() != renewed {
+		t.Errorf("Lock was renewed after stopping renewal.")
+	}
+}
+
+func TestLockRenewerCancelsOnLockLost(t *testing.T) {
+	consumer := newMemoryConsumer()
+	consumer.renewErr = &Error{StatusCode: 410, lockOperation: true}
+
+	var reported error
+	renewer := NewLockRenewer(consumer, WithRenewalErrorHandler(func(message *Message, err error) {
+		reported = err
+	}))
+
+	ctx, stop := renewer.Renew(context.Background(), lockedMessage(60*time.Millisecond))
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Handler context was not cancelled when the lock was lost.")
+	}
+
+	if reported == nil {
+		t.Errorf("Lost lock was not reported.")
+	}
+}
+
+func TestLockRenewerStopsAfterMaxDuration(t *testing.T) {
+	consumer := newMemoryConsumer()
+	renewer := NewLockRenewer(consumer, WithMaxRenewalDuration(100*time.Millisecond))
+
+	ctx, stop := renewer.Renew(context.Background(), lockedMessage(60*time.Millisecond))
+	defer stop()
+	time.Sleep(300 * time.Millisecond)
+
+	if consumer.renewals() == 0 || consumer.renewals() > 3 {
+		t.Errorf("Lock was renewed %d times within the max duration.", consumer.renewals())
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Handler context was cancelled when renewal ended.")
+	}
+}
+
+func TestProcessorAutoLockRenewal(t *testing.T) {
+	consumer := newMemoryConsumer(lockedMessage(90 * time.Millisecond))
+	done := make(chan struct{})
+	processor := NewProcessor(consumer, func(ctx context.Context, message *Message) error {
+		defer close(done)
+		time.Sleep(200 * time.Millisecond)
+		return ctx.Err()
+	}, WithReceiveTimeout(1), WithAutoLockRenewal(time.Minute))
+
+	processor.Start(context.Background())
+	<-done
+	processor.Stop(context.Background())
+
+	if consumer.renewals() == 0 {
+		t.Errorf("Processor did not renew the lock of the message.")
+	}
+	if deleted, _ := consumer.settled(); deleted != 1 {
+		t.Errorf("Processor did not delete the handled message.")
+	}
+}
@@ -2,6 +2,7 @@ package azureservicebus
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -11,23 +12,145 @@ import (
 // Message maps to a Azure Service Bus message with broker
 // properties and properties for custom properties as well
 type Message struct {
-	MessageID              string `json:"MessageId"`
-	DeliveryCount          int
-	EnqueuedSequenceNumber int
-	EnqueuedTimeUtc        dateTime
-	LockToken              string
-	LockedUntilUtc         dateTime
-	PartitionKey           string
-	SequenceNumber         int
-	State                  string
-	TimeToLive             float64
+	MessageID               string `json:"MessageId"`
+	CorrelationID           string `json:"CorrelationId"`
+	SessionID               string `json:"SessionId"`
+	ReplyToSessionID        string `json:"ReplyToSessionId"`
+	Label                   string
+	ReplyTo                 string
+	To                      string
+	ContentType             string
+	DeliveryCount           int
+	EnqueuedSequenceNumber  int
+	EnqueuedTimeUtc         dateTime
+	LockToken               string
+	LockedUntilUtc          dateTime
+	PartitionKey            string
+	SequenceNumber          int
+	State                   string
+	TimeToLive              float64
+	ScheduledEnqueueTimeUtc dateTime
 
 	Location string
 
-	Properties map[string]string `json:"Properties"`
+	Properties Properties `json:"Properties"`
 	Body       []byte
 }
 
+// brokerProperties holds the broker properties which can be
+// set by a sender, serialized into the BrokerProperties header
+type brokerProperties struct {
+	MessageID        string  `json:"MessageId,omitempty"`
+	CorrelationID    string  `json:"CorrelationId,omitempty"`
+	SessionID        string  `json:"SessionId,omitempty"`
+	ReplyToSessionID string  `json:"ReplyToSessionId,omitempty"`
+	Label            string  `json:"Label,omitempty"`
+	ReplyTo          string  `json:"ReplyTo,omitempty"`
+	To               string  `json:"To,omitempty"`
+	PartitionKey     string  `json:"PartitionKey,omitempty"`
+	TimeToLive       float64 `json:"TimeToLive,omitempty"`
+
+	ScheduledEnqueueTimeUtc string `json:"ScheduledEnqueueTimeUtc,omitempty"`
+}
+
+const maxBrokerPropertyLength = 128
+
+func (m *Message) brokerProperties() *brokerProperties {
+	var scheduled string
+	if !m.ScheduledEnqueueTimeUtc.IsZero() {
+		scheduled = m.ScheduledEnqueueTimeUtc.UTC().Format(http.TimeFormat)
+	}
+
+	return &brokerProperties{
+		MessageID:        m.MessageID,
+		CorrelationID:    m.CorrelationID,
+		SessionID:        m.SessionID,
+		ReplyToSessionID: m.ReplyToSessionID,
+		Label:            m.Label,
+		ReplyTo:          m.ReplyTo,
+		To:               m.To,
+		PartitionKey:     m.PartitionKey,
+		TimeToLive:       m.TimeToLive,
+
+		ScheduledEnqueueTimeUtc: scheduled,
+	}
+}
+
+// marshalBrokerProperties serializes the broker properties of the message
+// for the BrokerProperties header, returning nil when none are set
+func (m *Message) marshalBrokerProperties() ([]byte, error) {
+	props := m.brokerProperties()
+	if *props == (brokerProperties{}) {
+		return nil, nil
+	}
+
+	return json.Marshal(props)
+}
+
+// Validate checks that the broker properties of the message
+// are accepted by Azure Service Bus
+func (m *Message) Validate() error {
+	limited := []struct {
+		name  string
+		value string
+	}{
+		{"MessageId", m.MessageID},
+		{"SessionId", m.SessionID},
+		{"ReplyToSessionId", m.ReplyToSessionID},
+		{"PartitionKey", m.PartitionKey},
+	}
+	for _, p := range limited {
+		if len(p.value) > maxBrokerPropertyLength {
+			return fmt.Errorf("%w: %s exceeds %d characters", ErrInvalidMessage, p.name, maxBrokerPropertyLength)
+		}
+	}
+
+	if m.SessionID != "" && m.PartitionKey != "" && m.SessionID != m.PartitionKey {
+		return fmt.Errorf("%w: PartitionKey must equal SessionId when both are set", ErrInvalidMessage)
+	}
+	if m.TimeToLive < 0 {
+		return fmt.Errorf("%w: TimeToLive must not be negative", ErrInvalidMessage)
+	}
+
+	return nil
+}
+
+// size returns the serialized size of the message as sent; the body,
+// the broker properties, the content type and the custom properties
+func (m *Message) size() (int, error) {
+	props, err := m.marshalBrokerProperties()
+	if err != nil {
+		return 0, err
+	}
+
+	size := len(m.Body) + len(props) + len(m.ContentType)
+	for key, value := range m.Properties {
+		encoded, err := encodePropertyValue(value)
+		if err != nil {
+			return 0, err
+		}
+		size += len(key) + len(encoded)
+	}
+
+	return size, nil
+}
+
+// schedule sets the time at which the message is enqueued, validating
+// that it is in the future and within the time to live of the message
+func (m *Message) schedule(at time.Time, now time.Time) error {
+	if !at.After(now) {
+		return fmt.Errorf("%w: scheduled enqueue time %s is not in the future", ErrInvalidMessage, at.Format(time.RFC3339))
+	}
+
+	ttl := time.Duration(m.TimeToLive * float64(time.Second))
+	if ttl > 0 && at.Sub(now) > ttl {
+		return fmt.Errorf("%w: scheduled enqueue time %s exceeds the time to live of %s", ErrInvalidMessage, at.Format(time.RFC3339), ttl)
+	}
+
+	m.ScheduledEnqueueTimeUtc = dateTime{at}
+	return nil
+}
+
 type dateTime struct {
 	time.Time
 }
@@ -43,8 +166,25 @@ func (t *dateTime) UnmarshalJSON(b []byte) (err error) {
 }
 
 // ResponseToMessage reads a response byte stream and
-// creates a new Message instance from it
+// creates a new Message instance from it, decompressing
+// the body if it is marked with the ContentEncoding property,
+// up to four times the standard tier message size
 func ResponseToMessage(resp *http.Response) (*Message, error) {
+	message, err := responseToMessage(resp)
+	if err != nil {
+		return message, err
+	}
+
+	if err := decompressMessage(message, decompressionFactor*defaultMaxMessageSize); err != nil {
+		return message, err
+	}
+
+	return message, nil
+}
+
+// responseToMessage creates a Message from a response as sent,
+// leaving the body to be transformed by interceptors
+func responseToMessage(resp *http.Response) (*Message, error) {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -60,19 +200,23 @@ func ResponseToMessage(resp *http.Response) (*Message, error) {
 
 	message.Location = location
 	message.Body = body
+	if contentType := resp.Header.Get("content-type"); contentType != "" {
+		message.ContentType = contentType
+	}
 
-	properties := make(map[string]string)
+	properties := make(Properties)
 	presets := map[string]int{
 		"brokerproperties":          1,
 		"strict-transport-security": 1,
 		"content-type":              1,
+		"content-length":            1,
 		"location":                  1,
 		"server":                    1,
 		"date":                      1,
 	}
 	for key, value := range resp.Header {
 		if presets[strings.ToLower(key)] != 1 {
-			properties[strings.ToLower(key)] = strings.Trim(value[0], "\n\r\t\"'")
+			properties[strings.ToLower(key)] = decodePropertyValue(value[0])
 		}
 	}
 
@@ -0,0 +1,64 @@
+package azureservicebus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageValidate(t *testing.T) {
+	valid := &Message{MessageID: "id", SessionID: "session", PartitionKey: "session", TimeToLive: 60}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Valid message did not pass validation: %v", err)
+	}
+
+	invalid := []*Message{
+		{MessageID: strings.Repeat("x", 129)},
+		{SessionID: "session", PartitionKey: "other"},
+		{TimeToLive: -1},
+	}
+	for _, message := range invalid {
+		if err := message.Validate(); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("Invalid message passed validation.")
+		}
+	}
+}
+
+func TestMessageMarshalBrokerProperties(t *testing.T) {
+	props, err := (&Message{}).marshalBrokerProperties()
+	if err != nil || props != nil {
+		t.Errorf("Message without broker properties was serialized.")
+	}
+
+	props, err = (&Message{MessageID: "id", CorrelationID: "correlation", Label: "label"}).marshalBrokerProperties()
+	if err != nil {
+		t.Errorf("Could not serialize broker properties.")
+	}
+	if string(props) != `{"MessageId":"id","CorrelationId":"correlation","Label":"label"}` {
+		t.Errorf("Broker properties were not serialized correctly: %s", props)
+	}
+}
+
+func TestMessageSchedule(t *testing.T) {
+	now := time.Date(2018, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	message := &Message{TimeToLive: 3600}
+	if err := message.schedule(now.Add(-time.Minute), now); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Message scheduled in the past passed validation.")
+	}
+	if err := message.schedule(now.Add(2*time.Hour), now); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Message scheduled beyond its time to live passed validation.")
+	}
+	if err := message.schedule(now.Add(30*time.Minute), now); err != nil {
+		t.Errorf("Could not schedule message: %v", err)
+	}
+
+	props, err := message.marshalBrokerProperties()
+	if err != nil {
+		t.Errorf("Could not serialize broker properties.")
+	}
+	if !strings.Contains(string(props), `"ScheduledEnqueueTimeUtc":"Wed, 10 Jan 2018 12:30:00 GMT"`) {
+		t.Errorf("Scheduled enqueue time was not serialized in RFC1123 format: %s", props)
+	}
+}
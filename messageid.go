@@ -0,0 +1,100 @@
+package azureservicebus
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// MessageIDGenerator creates the MessageId of messages sent without
+// one. The id is stored on the message, so retrying a send of the same
+// message reuses it and lets duplicate detection discard the retry.
+type MessageIDGenerator interface {
+	MessageID(message *Message) (string, error)
+}
+
+// MessageIDFunc adapts a function to a MessageIDGenerator
+type MessageIDFunc func(message *Message) (string, error)
+
+// MessageID calls f(message)
+func (f MessageIDFunc) MessageID(message *Message) (string, error) {
+	return f(message)
+}
+
+var (
+	// UUIDMessageID generates a random (version 4) UUID
+	UUIDMessageID MessageIDGenerator = MessageIDFunc(uuidMessageID)
+	// ContentHashMessageID generates a SHA-256 hash of the body and the
+	// custom properties, so equal messages get equal ids
+	ContentHashMessageID MessageIDGenerator = MessageIDFunc(contentHashMessageID)
+)
+
+// KeyMessageID uses a key derived from the message, such as the
+// id of the domain event it carries, as MessageId
+func KeyMessageID(key func(message *Message) string) MessageIDGenerator {
+	return MessageIDFunc(func(message *Message) (string, error) {
+		return key(message), nil
+	})
+}
+
+// WithMessageIDGenerator sets the generator used for messages
+// sent without a MessageId
+func WithMessageIDGenerator(generator MessageIDGenerator) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.messageIDGenerator = generator
+	}
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func uuidMessageID(message *Message) (string, error) {
+	return newUUID()
+}
+
+func contentHashMessageID(message *Message) (string, error) {
+	keys := make([]string, 0, len(message.Properties))
+	for key := range message.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	hash.Write(message.Body)
+	for _, key := range keys {
+		encoded, err := encodePropertyValue(message.Properties[key])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "\n%s:%s", key, encoded)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// applyMessageID sets the MessageId of a message sent without
+// one, when the client has a generator
+func applyMessageID(client *HTTPRequestClient, message *Message) error {
+	if message.MessageID != "" || client.messageIDGenerator == nil {
+		return nil
+	}
+
+	id, err := client.messageIDGenerator.MessageID(message)
+	if err != nil {
+		return err
+	}
+
+	message.MessageID = id
+	return nil
+}
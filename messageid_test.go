@@ -0,0 +1,58 @@
+package azureservicebus
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestUUIDMessageID(t *testing.T) {
+	id, err := UUIDMessageID.MessageID(&Message{})
+	if err != nil {
+		t.Errorf("Could not generate UUID.")
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("Generated id %s is not a version 4 UUID.", id)
+	}
+}
+
+func TestContentHashMessageID(t *testing.T) {
+	first, _ := ContentHashMessageID.MessageID(&Message{Body: []byte("test-body"), Properties: Properties{"a": "1", "b": int64(2)}})
+	second, _ := ContentHashMessageID.MessageID(&Message{Body: []byte("test-body"), Properties: Properties{"b": int64(2), "a": "1"}})
+	other, _ := ContentHashMessageID.MessageID(&Message{Body: []byte("test-body"), Properties: Properties{"a": "2", "b": int64(2)}})
+
+	if first != second {
+		t.Errorf("Equal messages did not get equal ids.")
+	}
+	if first == other {
+		t.Errorf("Messages with different properties got equal ids.")
+	}
+}
+
+func TestSendAppliesMessageIDGenerator(t *testing.T) {
+	var ids []string
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get("BrokerProperties"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer ts.Close()
+	WithMessageIDGenerator(UUIDMessageID)(hrc)
+
+	sender := newSender(hrc, "test-queue")
+	message := &Message{Body: []byte("test-body")}
+	sender.Send(message)
+	sender.Send(message)
+
+	if message.MessageID == "" {
+		t.Fatalf("Message id was not generated.")
+	}
+	if len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("Retried send did not reuse the message id.")
+	}
+
+	keyed := &Message{Body: []byte("test-body"), MessageID: "existing"}
+	sender.Send(keyed)
+	if keyed.MessageID != "existing" {
+		t.Errorf("Existing message id was replaced.")
+	}
+}
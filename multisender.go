@@ -0,0 +1,135 @@
+package azureservicebus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DestinationResult is the outcome of sending a message to one
+// destination of a MultiSender
+type DestinationResult struct {
+	Destination string
+	Err         error
+	// Compensated is set when the message was sent, and successfully
+	// compensated for because another destination failed
+	Compensated bool
+	// CompensationErr is the error of a failed compensation
+	CompensationErr error
+}
+
+// MultiSendError is returned when a message could not be sent
+// to one or more destinations
+type MultiSendError struct {
+	Results []DestinationResult
+}
+
+func (e *MultiSendError) Error() string {
+	failed := 0
+	var first error
+	for _, result := range e.Results {
+		if result.Err != nil {
+			failed++
+			if first == nil {
+				first = result.Err
+			}
+		}
+	}
+
+	return fmt.Sprintf("Could not send message to %d of %d destinations: %v", failed, len(e.Results), first)
+}
+
+// Unwrap returns the error of the first failed destination
+func (e *MultiSendError) Unwrap() error {
+	for _, result := range e.Results {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// CompensateFunc undoes the effect of a message sent to a destination,
+// for example by sending a cancellation message
+type CompensateFunc func(ctx context.Context, destination string, message *Message) error
+
+// MultiSenderOption configures a MultiSender
+type MultiSenderOption func(*MultiSender)
+
+// WithCompensation makes sends all-or-nothing; when any destination
+// fails, compensate is called for every destination the message was
+// sent to. Azure Service Bus cannot retract a sent message, so
+// compensation is left to the caller.
+func WithCompensation(compensate CompensateFunc) MultiSenderOption {
+	return func(m *MultiSender) {
+		m.compensate = compensate
+	}
+}
+
+// MultiSender sends a message to several queues or topics concurrently,
+// through the HTTPRequestClient of a namespace
+type MultiSender struct {
+	client       *HTTPRequestClient
+	destinations []string
+	compensate   CompensateFunc
+}
+
+// NewMultiSender creates a MultiSender for queues or topics of the namespace
+func NewMultiSender(ns *Namespace, destinations []string, opts ...MultiSenderOption) *MultiSender {
+	m := &MultiSender{
+		client:       ns.client,
+		destinations: destinations,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Send sends the message to every destination, returning a result per
+// destination in the order they were given. A *MultiSendError is
+// returned when any destination failed. All destinations receive the
+// same MessageId.
+func (m *MultiSender) Send(ctx context.Context, message *Message) ([]DestinationResult, error) {
+	if err := applyMessageID(m.client, message); err != nil {
+		return nil, err
+	}
+
+	results := make([]DestinationResult, len(m.destinations))
+
+	var wg sync.WaitGroup
+	for i, destination := range m.destinations {
+		results[i].Destination = destination
+
+		wg.Add(1)
+		go func(result *DestinationResult, destination string) {
+			defer wg.Done()
+			result.Err = send(ctx, m.client, destination, message.clone())
+		}(&results[i], destination)
+	}
+	wg.Wait()
+
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		return results, nil
+	}
+
+	if m.compensate != nil {
+		for i := range results {
+			if results[i].Err == nil {
+				err := m.compensate(ctx, results[i].Destination, message)
+				results[i].Compensated = err == nil
+				results[i].CompensationErr = err
+			}
+		}
+	}
+
+	return results, &MultiSendError{Results: results}
+}
@@ -0,0 +1,67 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestMultiSenderNamespace(t *testing.T) (*Namespace, func()) {
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/missing/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	WithMessageIDGenerator(UUIDMessageID)(hrc)
+
+	return NewNamespaceWithClient(hrc), ts.Close
+}
+
+func TestMultiSender(t *testing.T) {
+	ns, closeServer := newTestMultiSenderNamespace(t)
+	defer closeServer()
+
+	sender := NewMultiSender(ns, []string{"orders", "audit"})
+	results, err := sender.Send(context.Background(), &Message{Body: []byte("test-body")})
+	if err != nil {
+		t.Fatalf("Could not send to all destinations: %v", err)
+	}
+	if len(results) != 2 || results[0].Destination != "orders" || results[1].Destination != "audit" {
+		t.Errorf("Results were not reported per destination.")
+	}
+}
+
+func TestMultiSenderPartialFailure(t *testing.T) {
+	ns, closeServer := newTestMultiSenderNamespace(t)
+	defer closeServer()
+
+	var mu sync.Mutex
+	var compensated []string
+	sender := NewMultiSender(ns, []string{"orders", "missing", "audit"}, WithCompensation(func(ctx context.Context, destination string, message *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		compensated = append(compensated, destination)
+		return nil
+	}))
+
+	results, err := sender.Send(context.Background(), &Message{Body: []byte("test-body")})
+
+	var multiErr *MultiSendError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("Partial failure did not return a MultiSendError.")
+	}
+	if !errors.Is(err, ErrEntityNotFound) {
+		t.Errorf("MultiSendError did not match the destination error.")
+	}
+	if results[1].Err == nil || results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("Results did not report the failed destination.")
+	}
+	if len(compensated) != 2 || !results[0].Compensated || !results[2].Compensated {
+		t.Errorf("Successful destinations were not compensated.")
+	}
+}
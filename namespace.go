@@ -0,0 +1,77 @@
+package azureservicebus
+
+// Namespace represents an Azure Service Bus namespace, handing out
+// clients for its queues, topics and subscriptions. All clients created
+// from the same Namespace share a single HTTPRequestClient, and with it
+// the connection pool and the cached authorization token.
+type Namespace struct {
+	client *HTTPRequestClient
+}
+
+// NewNamespace creates a new Namespace from a standard Azure Service
+// Bus connection string, configured by the options
+func NewNamespace(cnxString string, opts ...Option) (*Namespace, error) {
+	cnx, err := ParseConnectionString(cnxString)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewNamespaceWithClient(NewHTTPRequestClient(cnx, opts...)), nil
+}
+
+// NewNamespaceWithClient creates a new Namespace on top of an
+// existing HTTPRequestClient
+func NewNamespaceWithClient(client *HTTPRequestClient) *Namespace {
+	return &Namespace{client: client}
+}
+
+// HTTPRequestClient returns the client shared by all entities
+// of the namespace
+func (ns *Namespace) HTTPRequestClient() *HTTPRequestClient {
+	return ns.client
+}
+
+// QueueClient creates a client aimed at queue communication
+func (ns *Namespace) QueueClient(queueName string) Client {
+	return &entityClient{
+		sender:   newSender(ns.client, queuePath(queueName)),
+		receiver: newReceiver(ns.client, queuePath(queueName)),
+	}
+}
+
+// PubSubClient creates a client aimed at either sending messages to
+// a topic or receiving messages from a subscription
+func (ns *Namespace) PubSubClient(topic string, subscription string) Client {
+	return &entityClient{
+		sender:   newSender(ns.client, topic),
+		receiver: newReceiver(ns.client, subscriptionPath(topic, subscription)),
+	}
+}
+
+// QueueSender creates a sender aimed at sending messages to a queue
+func (ns *Namespace) QueueSender(queueName string) Sender {
+	return newSender(ns.client, queuePath(queueName))
+}
+
+// TopicSender creates a sender aimed at publishing messages to a topic
+func (ns *Namespace) TopicSender(topic string) Sender {
+	return newSender(ns.client, topic)
+}
+
+// QueueReceiver creates a consumer aimed at receiving and settling
+// messages from a queue
+func (ns *Namespace) QueueReceiver(queueName string) Consumer {
+	return newReceiver(ns.client, queuePath(queueName))
+}
+
+// SubscriptionReceiver creates a consumer aimed at receiving and
+// settling messages from a subscription
+func (ns *Namespace) SubscriptionReceiver(topic string, subscription string) Consumer {
+	return newReceiver(ns.client, subscriptionPath(topic, subscription))
+}
+
+// Settler creates a settler for messages received from any entity
+// in the namespace
+func (ns *Namespace) Settler() Settler {
+	return &settler{client: ns.client}
+}
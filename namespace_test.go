@@ -0,0 +1,28 @@
+package azureservicebus
+
+import "testing"
+
+func TestNewNamespace(t *testing.T) {
+	ns, err := NewNamespace("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=TestSharedAccessKey;SharedAccessKey=TestSharedAccessKey")
+	if err != nil {
+		t.Errorf("Could not create namespace.")
+	}
+	if ns == nil {
+		t.Fatalf("Namespace is nil.")
+	}
+
+	queue := ns.QueueClient("test-queue").(*entityClient)
+	topic := ns.TopicSender("test-topic").(*sender)
+	subscription := ns.SubscriptionReceiver("test-topic", "test-subscription").(*receiver)
+
+	if queue.sender.client != ns.HTTPRequestClient() || topic.client != ns.HTTPRequestClient() || subscription.client != ns.HTTPRequestClient() {
+		t.Errorf("Clients created from the same namespace do not share HTTP client.")
+	}
+}
+
+func TestNewNamespaceInvalidConnectionString(t *testing.T) {
+	_, err := NewNamespace("no-valid-connection-string")
+	if err == nil {
+		t.Errorf("Namespace was created from an invalid connectionstring.")
+	}
+}
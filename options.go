@@ -0,0 +1,92 @@
+package azureservicebus
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a HTTPRequestClient, and with it every client
+// created on top of it
+type Option func(*HTTPRequestClient)
+
+// Logger is the minimal logging interface used by the HTTPRequestClient,
+// satisfied by *log.Logger
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// WithHTTPClient sets the http.Client used to execute requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.client = client
+	}
+}
+
+// WithOperationTimeout sets the default timeout for operations
+// that are not long polling for messages
+func WithOperationTimeout(timeout time.Duration) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.operationTimeout = timeout
+	}
+}
+
+// WithAPIVersion sets the Azure Service Bus REST API version
+// sent with every request
+func WithAPIVersion(version string) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.apiVersion = version
+	}
+}
+
+// WithLogger sets a logger which receives a line for every
+// executed request
+func WithLogger(logger Logger) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.logger = logger
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.userAgent = userAgent
+	}
+}
+
+// Tier is the pricing tier of an Azure Service Bus namespace,
+// which determines the maximum message size
+type Tier int
+
+const (
+	// TierStandard allows messages of up to 256 KB
+	TierStandard Tier = iota
+	// TierPremium allows messages of up to 1 MB
+	TierPremium
+)
+
+const premiumMaxMessageSize = 1024 * 1024
+
+// WithTier sets the maximum message size to the limit of the tier
+func WithTier(tier Tier) Option {
+	return func(hrc *HTTPRequestClient) {
+		switch tier {
+		case TierPremium:
+			hrc.maxMessageSize = premiumMaxMessageSize
+		default:
+			hrc.maxMessageSize = defaultMaxMessageSize
+		}
+	}
+}
+
+// WithMaxMessageSize sets the maximum size in bytes of a message,
+// including its properties, or of a batch of messages. Messages are
+// validated against it before sending.
+func WithMaxMessageSize(size int) Option {
+	return func(hrc *HTTPRequestClient) {
+		hrc.maxMessageSize = size
+	}
+}
@@ -0,0 +1,142 @@
+package azureservicebus
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLOutboxOption configures a SQLOutboxStore
+type SQLOutboxOption func(*SQLOutboxStore)
+
+// WithDollarPlaceholders uses $1, $2, ... placeholders as expected
+// by PostgreSQL drivers, instead of ?
+func WithDollarPlaceholders() SQLOutboxOption {
+	return func(s *SQLOutboxStore) {
+		s.placeholder = func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		}
+	}
+}
+
+// SQLOutboxStore keeps outbox entries in a database table. Use AddTx
+// to store an entry in the same transaction as the business data it
+// describes; the relay reads and removes entries through the *sql.DB.
+//
+// The table needs the columns
+//
+//	id          VARCHAR(64) PRIMARY KEY
+//	message_key VARCHAR(255)
+//	payload     TEXT
+//	created_at  TIMESTAMP
+//	attempts    INTEGER
+//
+// Entry ids sort in creation order, which is the order of Pending.
+// Pending takes no row locks, so run a single relay per table; entries
+// read by several relays at once would be sent more than once.
+type SQLOutboxStore struct {
+	db          *sql.DB
+	table       string
+	placeholder func(n int) string
+}
+
+// NewSQLOutboxStore creates an outbox store for a table
+func NewSQLOutboxStore(db *sql.DB, table string, opts ...SQLOutboxOption) *SQLOutboxStore {
+	s := &SQLOutboxStore{
+		db:    db,
+		table: table,
+		placeholder: func(n int) string {
+			return "?"
+		},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *SQLOutboxStore) placeholders(n int) string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = s.placeholder(i + 1)
+	}
+	return strings.Join(p, ", ")
+}
+
+// Add stores a new entry in its own statement
+func (s *SQLOutboxStore) Add(ctx context.Context, entry *OutboxEntry) error {
+	return s.insert(ctx, s.db, entry)
+}
+
+// AddTx stores a new entry as part of the transaction, so it is only
+// relayed if the transaction commits
+func (s *SQLOutboxStore) AddTx(ctx context.Context, tx *sql.Tx, entry *OutboxEntry) error {
+	return s.insert(ctx, tx, entry)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *SQLOutboxStore) insert(ctx context.Context, db execer, entry *OutboxEntry) error {
+	if err := prepareOutboxEntry(entry); err != nil {
+		return err
+	}
+
+	payload, err := marshalOutboxMessage(entry.Message)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (id, message_key, payload, created_at, attempts) VALUES (%s)", s.table, s.placeholders(5))
+	_, err = db.ExecContext(ctx, query, entry.ID, entry.Key, string(payload), entry.CreatedAt, entry.Attempts)
+	return err
+}
+
+// Pending returns up to limit entries, oldest first
+func (s *SQLOutboxStore) Pending(ctx context.Context, limit int) ([]*OutboxEntry, error) {
+	query := fmt.Sprintf("SELECT id, message_key, payload, created_at, attempts FROM %s ORDER BY id LIMIT %d", s.table, limit)
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []*OutboxEntry
+	for rows.Next() {
+		var entry OutboxEntry
+		var key sql.NullString
+		var payload string
+		if err := rows.Scan(&entry.ID, &key, &payload, &entry.CreatedAt, &entry.Attempts); err != nil {
+			return nil, err
+		}
+
+		message, err := unmarshalOutboxMessage([]byte(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Key = key.String
+		entry.Message = message
+		pending = append(pending, &entry)
+	}
+
+	return pending, rows.Err()
+}
+
+// MarkSent removes a relayed entry
+func (s *SQLOutboxStore) MarkSent(ctx context.Context, id string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = %s", s.table, s.placeholder(1))
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailed counts a failed attempt to relay an entry
+func (s *SQLOutboxStore) MarkFailed(ctx context.Context, id string) error {
+	query := fmt.Sprintf("UPDATE %s SET attempts = attempts + 1 WHERE id = %s", s.table, s.placeholder(1))
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
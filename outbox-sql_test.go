@@ -0,0 +1,307 @@
+package azureservicebus
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// outboxTestDriver is a database/sql driver understanding just the
+// statements of SQLOutboxStore, keeping one table per data source
+// name in memory and recording every query
+type outboxTestDriver struct {
+	mu        sync.Mutex
+	databases map[string]*outboxTestDatabase
+}
+
+type outboxTestDatabase struct {
+	mu      sync.Mutex
+	rows    map[string][]driver.Value
+	queries []string
+}
+
+var testOutboxDriver = &outboxTestDriver{databases: map[string]*outboxTestDatabase{}}
+
+func init() {
+	sql.Register("outboxtest", testOutboxDriver)
+}
+
+func (d *outboxTestDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	db, ok := d.databases[name]
+	if !ok {
+		db = &outboxTestDatabase{rows: map[string][]driver.Value{}}
+		d.databases[name] = db
+	}
+	return &outboxTestConn{db: db}, nil
+}
+
+// outboxTestConn buffers inserts of a transaction until it commits
+type outboxTestConn struct {
+	db      *outboxTestDatabase
+	tx      bool
+	pending [][]driver.Value
+}
+
+func (c *outboxTestConn) Prepare(query string) (driver.Stmt, error) {
+	return &outboxTestStmt{conn: c, query: query}, nil
+}
+
+func (c *outboxTestConn) Close() error {
+	return nil
+}
+
+func (c *outboxTestConn) Begin() (driver.Tx, error) {
+	c.tx = true
+	return c, nil
+}
+
+func (c *outboxTestConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	for _, row := range c.pending {
+		c.db.rows[row[0].(string)] = row
+	}
+	c.tx, c.pending = false, nil
+	return nil
+}
+
+func (c *outboxTestConn) Rollback() error {
+	c.tx, c.pending = false, nil
+	return nil
+}
+
+type outboxTestStmt struct {
+	conn  *outboxTestConn
+	query string
+}
+
+func (s *outboxTestStmt) Close() error {
+	return nil
+}
+
+func (s *outboxTestStmt) NumInput() int {
+	return -1
+}
+
+func (s *outboxTestStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.queries = append(db.queries, s.query)
+
+	switch {
+	case strings.HasPrefix(s.query, "INSERT"):
+		if s.conn.tx {
+			s.conn.pending = append(s.conn.pending, args)
+		} else {
+			db.rows[args[0].(string)] = args
+		}
+	case strings.HasPrefix(s.query, "DELETE"):
+		delete(db.rows, args[0].(string))
+	case strings.HasPrefix(s.query, "UPDATE"):
+		if row, ok := db.rows[args[0].(string)]; ok {
+			row[4] = row[4].(int64) + 1
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported statement: %s", s.query)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *outboxTestStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.queries = append(db.queries, s.query)
+
+	var limit int
+	if i := strings.Index(s.query, " LIMIT "); i < 0 || !strings.HasPrefix(s.query, "SELECT") {
+		return nil, fmt.Errorf("Unsupported query: %s", s.query)
+	} else if _, err := fmt.Sscanf(s.query[i:], " LIMIT %d", &limit); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(db.rows))
+	for id := range db.rows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	rows := &outboxTestRows{}
+	for _, id := range ids {
+		rows.rows = append(rows.rows, append([]driver.Value(nil), db.rows[id]...))
+	}
+	return rows, nil
+}
+
+type outboxTestRows struct {
+	rows [][]driver.Value
+}
+
+func (r *outboxTestRows) Columns() []string {
+	return []string{"id", "message_key", "payload", "created_at", "attempts"}
+}
+
+func (r *outboxTestRows) Close() error {
+	return nil
+}
+
+func (r *outboxTestRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func openOutboxTestDB(t *testing.T) (*sql.DB, *outboxTestDatabase) {
+	name := t.Name()
+	db, err := sql.Open("outboxtest", name)
+	if err != nil {
+		t.Fatalf("Could not open test database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Could not connect to test database: %v", err)
+	}
+
+	testOutboxDriver.mu.Lock()
+	defer testOutboxDriver.mu.Unlock()
+	return db, testOutboxDriver.databases[name]
+}
+
+func (db *outboxTestDatabase) executed() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.queries...)
+}
+
+func TestSQLOutboxStore(t *testing.T) {
+	ctx := context.Background()
+	db, testDB := openOutboxTestDB(t)
+	defer db.Close()
+
+	store := NewSQLOutboxStore(db, "outbox")
+	entry := NewOutboxEntry("order-1", &Message{Label: "created", Body: []byte("1")})
+	if err := store.Add(ctx, entry); err != nil {
+		t.Fatalf("Could not add entry: %v", err)
+	}
+	if err := store.Add(ctx, NewOutboxEntry("", &Message{Body: []byte("2")})); err != nil {
+		t.Fatalf("Could not add entry: %v", err)
+	}
+
+	pending, err := store.Pending(ctx, 1)
+	if err != nil {
+		t.Fatalf("Could not read pending entries: %v", err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Read %d pending entries, expected 1.", len(pending))
+	}
+	got := pending[0]
+	if got.ID != entry.ID || got.Key != "order-1" || got.Message.Label != "created" || string(got.Message.Body) != "1" {
+		t.Errorf("Pending entry does not match the added entry.")
+	}
+	if !got.CreatedAt.Equal(entry.CreatedAt) {
+		t.Errorf("Pending entry was created at %v, expected %v.", got.CreatedAt, entry.CreatedAt)
+	}
+
+	if err := store.MarkFailed(ctx, entry.ID); err != nil {
+		t.Errorf("Could not mark entry as failed: %v", err)
+	}
+	if pending, _ := store.Pending(ctx, 10); len(pending) != 2 || pending[0].Attempts != 1 {
+		t.Errorf("Failed attempt was not counted.")
+	}
+
+	if err := store.MarkSent(ctx, entry.ID); err != nil {
+		t.Errorf("Could not mark entry as sent: %v", err)
+	}
+	if pending, _ := store.Pending(ctx, 10); len(pending) != 1 || pending[0].ID == entry.ID {
+		t.Errorf("Sent entry was not removed.")
+	}
+
+	expected := []string{
+		"INSERT INTO outbox (id, message_key, payload, created_at, attempts) VALUES (?, ?, ?, ?, ?)",
+		"INSERT INTO outbox (id, message_key, payload, created_at, attempts) VALUES (?, ?, ?, ?, ?)",
+		"SELECT id, message_key, payload, created_at, attempts FROM outbox ORDER BY id LIMIT 1",
+		"UPDATE outbox SET attempts = attempts + 1 WHERE id = ?",
+		"SELECT id, message_key, payload, created_at, attempts FROM outbox ORDER BY id LIMIT 10",
+		"DELETE FROM outbox WHERE id = ?",
+		"SELECT id, message_key, payload, created_at, attempts FROM outbox ORDER BY id LIMIT 10",
+	}
+	queries := testDB.executed()
+	if strings.Join(queries, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Executed queries\n%s\nexpected\n%s", strings.Join(queries, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestSQLOutboxStoreDollarPlaceholders(t *testing.T) {
+	ctx := context.Background()
+	db, testDB := openOutboxTestDB(t)
+	defer db.Close()
+
+	store := NewSQLOutboxStore(db, "outbox", WithDollarPlaceholders())
+	entry := NewOutboxEntry("", &Message{Body: []byte("1")})
+	store.Add(ctx, entry)
+	store.MarkFailed(ctx, entry.ID)
+	store.MarkSent(ctx, entry.ID)
+
+	expected := []string{
+		"INSERT INTO outbox (id, message_key, payload, created_at, attempts) VALUES ($1, $2, $3, $4, $5)",
+		"UPDATE outbox SET attempts = attempts + 1 WHERE id = $1",
+		"DELETE FROM outbox WHERE id = $1",
+	}
+	queries := testDB.executed()
+	if strings.Join(queries, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Executed queries\n%s\nexpected\n%s", strings.Join(queries, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestSQLOutboxStoreAddTx(t *testing.T) {
+	ctx := context.Background()
+	db, _ := openOutboxTestDB(t)
+	defer db.Close()
+
+	store := NewSQLOutboxStore(db, "outbox")
+	sender := &recordingSender{}
+	relay := NewOutboxRelay(store, sender)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Could not begin transaction: %v", err)
+	}
+	if err := store.AddTx(ctx, tx, NewOutboxEntry("", &Message{Body: []byte("rolled back")})); err != nil {
+		t.Fatalf("Could not add entry in transaction: %v", err)
+	}
+	tx.Rollback()
+
+	if sent, err := relay.RelayOnce(ctx); err != nil || sent != 0 {
+		t.Errorf("Relay sent %d entries of a rolled back transaction.", sent)
+	}
+
+	tx, _ = db.BeginTx(ctx, nil)
+	store.AddTx(ctx, tx, NewOutboxEntry("", &Message{Body: []byte("committed")}))
+	tx.Commit()
+
+	if sent, err := relay.RelayOnce(ctx); err != nil || sent != 1 {
+		t.Errorf("Relay sent %d entries of a committed transaction, expected 1.", sent)
+	}
+	if sender.count() != 1 || string(sender.sent[0].Body) != "committed" {
+		t.Errorf("Relay did not send the committed entry.")
+	}
+}
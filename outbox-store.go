@@ -0,0 +1,239 @@
+package azureservicebus
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryOutboxStore keeps outbox entries in memory. It does not survive
+// a restart, and is meant for tests and for processes where an outbox
+// only decouples the caller from Service Bus latency.
+type MemoryOutboxStore struct {
+	mu      sync.Mutex
+	entries []*OutboxEntry
+}
+
+// NewMemoryOutboxStore creates an empty in-memory outbox store
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{}
+}
+
+// Add stores a new entry
+func (s *MemoryOutboxStore) Add(ctx context.Context, entry *OutboxEntry) error {
+	if err := prepareOutboxEntry(entry); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Pending returns up to limit entries, oldest first
+func (s *MemoryOutboxStore) Pending(ctx context.Context, limit int) ([]*OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit > len(s.entries) {
+		limit = len(s.entries)
+	}
+
+	pending := make([]*OutboxEntry, limit)
+	for i := range pending {
+		entry := *s.entries[i]
+		pending[i] = &entry
+	}
+	return pending, nil
+}
+
+// MarkSent removes a relayed entry
+func (s *MemoryOutboxStore) MarkSent(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, entry := range s.entries {
+		if entry.ID == id {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// MarkFailed counts a failed attempt to relay an entry
+func (s *MemoryOutboxStore) MarkFailed(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.ID == id {
+			entry.Attempts++
+			break
+		}
+	}
+	return nil
+}
+
+// outboxRecord is the stored form of an entry in a FileOutboxStore
+type outboxRecord struct {
+	ID        string          `json:"id"`
+	Key       string          `json:"key,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Attempts  int             `json:"attempts"`
+}
+
+// FileOutboxStore keeps outbox entries in a JSON file, rewritten
+// atomically on every change. It suits low-volume outboxes of a
+// single process; concurrent processes must not share the file.
+type FileOutboxStore struct {
+	mu      sync.Mutex
+	path    string
+	records []outboxRecord
+}
+
+// NewFileOutboxStore opens the outbox stored at path, creating
+// it on the first change if it does not exist
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	s := &FileOutboxStore{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.records); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(s.records, func(i, j int) bool {
+		return s.records[i].ID < s.records[j].ID
+	})
+	return s, nil
+}
+
+// Add stores a new entry
+func (s *FileOutboxStore) Add(ctx context.Context, entry *OutboxEntry) error {
+	if err := prepareOutboxEntry(entry); err != nil {
+		return err
+	}
+
+	payload, err := marshalOutboxMessage(entry.Message)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := append(s.records, outboxRecord{
+		ID:        entry.ID,
+		Key:       entry.Key,
+		Payload:   payload,
+		CreatedAt: entry.CreatedAt,
+		Attempts:  entry.Attempts,
+	})
+	return s.save(records)
+}
+
+// Pending returns up to limit entries, oldest first
+func (s *FileOutboxStore) Pending(ctx context.Context, limit int) ([]*OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit > len(s.records) {
+		limit = len(s.records)
+	}
+
+	pending := make([]*OutboxEntry, limit)
+	for i, record := range s.records[:limit] {
+		message, err := unmarshalOutboxMessage(record.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		pending[i] = &OutboxEntry{
+			ID:        record.ID,
+			Key:       record.Key,
+			Message:   message,
+			CreatedAt: record.CreatedAt,
+			Attempts:  record.Attempts,
+		}
+	}
+	return pending, nil
+}
+
+// MarkSent removes a relayed entry
+func (s *FileOutboxStore) MarkSent(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]outboxRecord, 0, len(s.records))
+	for _, record := range s.records {
+		if record.ID != id {
+			records = append(records, record)
+		}
+	}
+	return s.save(records)
+}
+
+// MarkFailed counts a failed attempt to relay an entry
+func (s *FileOutboxStore) MarkFailed(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]outboxRecord, len(s.records))
+	copy(records, s.records)
+	for i := range records {
+		if records[i].ID == id {
+			records[i].Attempts++
+		}
+	}
+	return s.save(records)
+}
+
+// save writes the records to a temporary file and renames it over
+// the store, only replacing the records in memory on success
+func (s *FileOutboxStore) save(records []outboxRecord) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.records = records
+	return nil
+}
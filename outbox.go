@@ -0,0 +1,321 @@
+package azureservicebus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// OutboxEntry is a message stored in an outbox, waiting to be relayed.
+// Entries with the same Key are relayed in the order they were added;
+// entries without a Key are relayed independently.
+type OutboxEntry struct {
+	ID        string
+	Key       string
+	Message   *Message
+	CreatedAt time.Time
+	Attempts  int
+}
+
+// OutboxStore persists outbox entries until they have been relayed.
+// Pending returns the oldest entries first.
+type OutboxStore interface {
+	Add(ctx context.Context, entry *OutboxEntry) error
+	Pending(ctx context.Context, limit int) ([]*OutboxEntry, error)
+	MarkSent(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string) error
+}
+
+// NewOutboxEntry creates an entry for a message with an ordering key
+func NewOutboxEntry(key string, message *Message) *OutboxEntry {
+	return &OutboxEntry{Key: key, Message: message}
+}
+
+var outboxSequence uint32
+
+// newOutboxID creates an id which sorts in creation order
+func newOutboxID(createdAt time.Time) (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	seq := atomic.AddUint32(&outboxSequence, 1)
+	return fmt.Sprintf("%016x-%08x-%s", createdAt.UnixNano(), seq, hex.EncodeToString(b[:])), nil
+}
+
+// prepareOutboxEntry assigns the id and creation time of a new entry
+func prepareOutboxEntry(entry *OutboxEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	if entry.ID == "" {
+		id, err := newOutboxID(entry.CreatedAt)
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+	}
+
+	return nil
+}
+
+// outboxPayload is the stored form of a message
+type outboxPayload struct {
+	BrokerProperties *brokerProperties `json:"BrokerProperties"`
+	ContentType      string            `json:"ContentType,omitempty"`
+	Properties       map[string]string `json:"Properties,omitempty"`
+	Body             []byte            `json:"Body"`
+}
+
+func marshalOutboxMessage(message *Message) ([]byte, error) {
+	payload := outboxPayload{
+		BrokerProperties: message.brokerProperties(),
+		ContentType:      message.ContentType,
+		Body:             message.Body,
+	}
+
+	if len(message.Properties) > 0 {
+		payload.Properties = make(map[string]string, len(message.Properties))
+		for key, value := range message.Properties {
+			encoded, err := encodePropertyValue(value)
+			if err != nil {
+				return nil, err
+			}
+			payload.Properties[key] = encoded
+		}
+	}
+
+	return json.Marshal(payload)
+}
+
+func unmarshalOutboxMessage(data []byte) (*Message, error) {
+	var payload outboxPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+
+	message := &Message{
+		ContentType: payload.ContentType,
+		Body:        payload.Body,
+	}
+
+	if props := payload.BrokerProperties; props != nil {
+		message.MessageID = props.MessageID
+		message.CorrelationID = props.CorrelationID
+		message.SessionID = props.SessionID
+		message.ReplyToSessionID = props.ReplyToSessionID
+		message.Label = props.Label
+		message.ReplyTo = props.ReplyTo
+		message.To = props.To
+		message.PartitionKey = props.PartitionKey
+		message.TimeToLive = props.TimeToLive
+
+		if props.ScheduledEnqueueTimeUtc != "" {
+			t, err := http.ParseTime(props.ScheduledEnqueueTimeUtc)
+			if err != nil {
+				return nil, err
+			}
+			message.ScheduledEnqueueTimeUtc = dateTime{t}
+		}
+	}
+
+	if len(payload.Properties) > 0 {
+		message.Properties = make(Properties, len(payload.Properties))
+		for key, value := range payload.Properties {
+			message.Properties[key] = decodePropertyValue(value)
+		}
+	}
+
+	return message, nil
+}
+
+const (
+	defaultRelayBatchSize  = 100
+	defaultRelayInterval   = time.Second
+	defaultRelayMaxBackoff = time.Minute
+)
+
+// OutboxRelayOption configures an OutboxRelay
+type OutboxRelayOption func(*OutboxRelay)
+
+// WithRelayBatchSize sets how many pending entries are read
+// from the store per round
+func WithRelayBatchSize(size int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.batchSize = size
+	}
+}
+
+// WithRelayInterval sets how long the relay waits between rounds
+func WithRelayInterval(interval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.interval = interval
+	}
+}
+
+// WithRelayMaxBackoff sets the longest wait between rounds while
+// sends keep failing
+func WithRelayMaxBackoff(backoff time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.maxBackoff = backoff
+	}
+}
+
+// WithRelayMaxAttempts gives up on an entry once sending it has
+// failed the specified number of times
+func WithRelayMaxAttempts(attempts int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.maxAttempts = attempts
+	}
+}
+
+// WithRelayDeadLetter sets a function called with every entry the
+// relay gives up on, before the entry is removed from the store
+func WithRelayDeadLetter(deadLetter func(entry *OutboxEntry, err error)) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.deadLetter = deadLetter
+	}
+}
+
+// OutboxRelay drains an OutboxStore through a Sender. An entry is
+// removed from the store only after it has been sent, so delivery is
+// at-least-once; each message is sent with the entry id as MessageId
+// unless it already has one, letting duplicate detection discard
+// messages resent after a crash.
+//
+// Entries which can never be sent, because they are invalid or too
+// large, and entries which reached the maximum number of attempts are
+// passed to the dead letter function and removed with MarkSent, so
+// they do not hold back the entries behind them.
+type OutboxRelay struct {
+	store       OutboxStore
+	sender      Sender
+	batchSize   int
+	interval    time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+	deadLetter  func(entry *OutboxEntry, err error)
+}
+
+// NewOutboxRelay creates a relay from a store to a sender
+func NewOutboxRelay(store OutboxStore, sender Sender, opts ...OutboxRelayOption) *OutboxRelay {
+	r := &OutboxRelay{
+		store:      store,
+		sender:     sender,
+		batchSize:  defaultRelayBatchSize,
+		interval:   defaultRelayInterval,
+		maxBackoff: defaultRelayMaxBackoff,
+		deadLetter: func(entry *OutboxEntry, err error) {},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// RelayOnce sends one round of pending entries, returning how many
+// were sent. Once an entry fails, later entries with the same key are
+// held back until the next round to preserve their order.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	entries, err := r.store.Pending(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	blocked := make(map[string]bool)
+	var firstErr error
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		if entry.Key != "" && blocked[entry.Key] {
+			continue
+		}
+
+		if entry.Message.MessageID == "" {
+			entry.Message.MessageID = entry.ID
+		}
+
+		if err := r.sender.SendContext(ctx, entry.Message); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			if r.dead(entry, err) {
+				r.deadLetter(entry, err)
+				if err := r.store.MarkSent(ctx, entry.ID); err != nil {
+					return sent, err
+				}
+				continue
+			}
+
+			if entry.Key != "" {
+				blocked[entry.Key] = true
+			}
+			if err := r.store.MarkFailed(ctx, entry.ID); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if err := r.store.MarkSent(ctx, entry.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, firstErr
+}
+
+// dead reports whether the relay gives up on an entry which failed
+func (r *OutboxRelay) dead(entry *OutboxEntry, err error) bool {
+	if errors.Is(err, ErrInvalidMessage) || errors.Is(err, ErrMessageTooLarge) {
+		return true
+	}
+	return r.maxAttempts > 0 && entry.Attempts+1 >= r.maxAttempts
+}
+
+// Run relays pending entries until the context is done, backing off
+// exponentially while sends fail
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	backoff := r.interval
+
+	for {
+		wait := r.interval
+
+		sent, err := r.RelayOnce(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			wait = backoff
+			backoff *= 2
+			if backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+		case sent == r.batchSize:
+			backoff = r.interval
+			continue
+		default:
+			backoff = r.interval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutboxRelayPreservesOrderPerKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryOutboxStore()
+	sender := &recordingSender{}
+
+	failing := &Message{Body: []byte("fail")}
+	store.Add(ctx, NewOutboxEntry("a", failing))
+	store.Add(ctx, NewOutboxEntry("a", &Message{Body: []byte("a2")}))
+	store.Add(ctx, NewOutboxEntry("b", &Message{Body: []byte("b1")}))
+
+	relay := NewOutboxRelay(store, sender)
+	sent, err := relay.RelayOnce(ctx)
+	if err == nil {
+		t.Errorf("Failed send was not reported.")
+	}
+	if sent != 1 || string(sender.sent[0].Body) != "b1" {
+		t.Errorf("Entry after a failed entry with the same key was relayed.")
+	}
+
+	pending, _ := store.Pending(ctx, 10)
+	if len(pending) != 2 || pending[0].Attempts != 1 {
+		t.Errorf("Failed entry was not kept with its attempt counted.")
+	}
+
+	failing.Body = []byte("a1")
+	if sent, err := relay.RelayOnce(ctx); err != nil || sent != 2 {
+		t.Errorf("Pending entries were not relayed after recovery.")
+	}
+	if string(sender.sent[1].Body) != "a1" || string(sender.sent[2].Body) != "a2" {
+		t.Errorf("Entries with the same key were relayed out of order.")
+	}
+	if sender.sent[1].MessageID != pending[0].ID {
+		t.Errorf("Relayed message did not use the entry id as MessageId.")
+	}
+}
+
+func TestOutboxRelayRun(t *testing.T) {
+	store := NewMemoryOutboxStore()
+	sender := &recordingSender{}
+	store.Add(context.Background(), NewOutboxEntry("", &Message{Body: []byte("1")}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := NewOutboxRelay(store, sender, WithRelayInterval(10*time.Millisecond)).Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Relay did not stop with the context.")
+	}
+	if sender.count() != 1 {
+		t.Errorf("Relay did not send the pending entry.")
+	}
+}
+
+func TestFileOutboxStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory.")
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "outbox.json")
+
+	store, err := NewFileOutboxStore(path)
+	if err != nil {
+		t.Fatalf("Could not create file outbox store: %v", err)
+	}
+
+	scheduled := time.Date(2030, 1, 10, 12, 0, 0, 0, time.UTC)
+	message := &Message{
+		CorrelationID:           "correlation",
+		ContentType:             "application/json",
+		ScheduledEnqueueTimeUtc: dateTime{scheduled},
+		Properties:              Properties{"Count": int64(3), "Name": "test"},
+		Body:                    []byte(`{"a":1}`),
+	}
+	store.Add(ctx, NewOutboxEntry("a", message))
+	store.Add(ctx, NewOutboxEntry("a", &Message{Body: []byte("second")}))
+
+	reopened, err := NewFileOutboxStore(path)
+	if err != nil {
+		t.Fatalf("Could not reopen file outbox store: %v", err)
+	}
+
+	pending, err := reopened.Pending(ctx, 10)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("Reopened store did not contain the stored entries.")
+	}
+
+	stored := pending[0].Message
+	if stored.CorrelationID != "correlation" || stored.ContentType != "application/json" || string(stored.Body) != `{"a":1}` {
+		t.Errorf("Stored message did not round trip.")
+	}
+	if !stored.ScheduledEnqueueTimeUtc.Equal(scheduled) {
+		t.Errorf("Scheduled enqueue time did not round trip.")
+	}
+	if n, ok := stored.Properties.Int64("Count"); !ok || n != 3 {
+		t.Errorf("Typed properties did not round trip.")
+	}
+
+	reopened.MarkSent(ctx, pending[0].ID)
+	reopened, _ = NewFileOutboxStore(path)
+	if pending, _ := reopened.Pending(ctx, 10); len(pending) != 1 || string(pending[0].Message.Body) != "second" {
+		t.Errorf("Sent entry was not removed from the file.")
+	}
+}
+
+// rejectingSender is a recordingSender rejecting messages
+// labelled "invalid" as ErrInvalidMessage
+type rejectingSender struct {
+	recordingSender
+}
+
+func (s *rejectingSender) SendContext(ctx context.Context, message *Message) error {
+	if message.Label == "invalid" {
+		return fmt.Errorf("%w: rejected", ErrInvalidMessage)
+	}
+	return s.recordingSender.SendContext(ctx, message)
+}
+
+func TestOutboxRelayDeadLettersInvalidEntries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryOutboxStore()
+	sender := &rejectingSender{}
+
+	store.Add(ctx, NewOutboxEntry("a", &Message{Label: "invalid", Body: []byte("a1")}))
+	store.Add(ctx, NewOutboxEntry("a", &Message{Body: []byte("a2")}))
+
+	var dead []*OutboxEntry
+	relay := NewOutboxRelay(store, sender, WithRelayBatchSize(1), WithRelayDeadLetter(func(entry *OutboxEntry, err error) {
+		if !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("Dead letter function got %v, expected ErrInvalidMessage.", err)
+		}
+		dead = append(dead, entry)
+	}))
+
+	for i := 0; i < 2; i++ {
+		relay.RelayOnce(ctx)
+	}
+
+	if len(dead) != 1 || string(dead[0].Message.Body) != "a1" {
+		t.Errorf("Invalid entry was not dead lettered.")
+	}
+	if sender.count() != 1 || string(sender.sent[0].Body) != "a2" {
+		t.Errorf("Entry behind an invalid entry was not relayed.")
+	}
+	if pending, _ := store.Pending(ctx, 10); len(pending) != 0 {
+		t.Errorf("Dead lettered entry was kept in the store.")
+	}
+}
+
+func TestOutboxRelayMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryOutboxStore()
+	sender := &recordingSender{}
+
+	store.Add(ctx, NewOutboxEntry("", &Message{Body: []byte("fail")}))
+	store.Add(ctx, NewOutboxEntry("", &Message{Body: []byte("ok")}))
+
+	dead := 0
+	relay := NewOutboxRelay(store, sender, WithRelayBatchSize(1), WithRelayMaxAttempts(3),
+		WithRelayDeadLetter(func(entry *OutboxEntry, err error) {
+			dead++
+		}))
+
+	for i := 0; i < 4; i++ {
+		relay.RelayOnce(ctx)
+	}
+
+	if dead != 1 {
+		t.Errorf("Entry failing %d times was dead lettered %d times, expected once.", 3, dead)
+	}
+	if sender.count() != 1 || string(sender.sent[0].Body) != "ok" {
+		t.Errorf("Entry behind a failing entry was not relayed.")
+	}
+}
@@ -0,0 +1,90 @@
+package azureservicebus
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// PoisonReasonProperty holds the error of the last failed
+	// delivery of a parked message
+	PoisonReasonProperty = "PoisonReason"
+	// PoisonDeliveryCountProperty holds the delivery count
+	// of a message when it was parked
+	PoisonDeliveryCountProperty = "PoisonDeliveryCount"
+	// PoisonSourceProperty holds the path of the entity
+	// a parked message was received from
+	PoisonSourceProperty = "PoisonSource"
+	// PoisonParkedAtProperty holds the time a message was parked
+	PoisonParkedAtProperty = "PoisonParkedAt"
+)
+
+// PoisonPolicyOption configures a PoisonPolicy
+type PoisonPolicyOption func(*PoisonPolicy)
+
+// WithPoisonCallback sets a function called with every message
+// which has been parked, before the original is deleted
+func WithPoisonCallback(onPoison func(message *Message, reason error)) PoisonPolicyOption {
+	return func(p *PoisonPolicy) {
+		p.onPoison = onPoison
+	}
+}
+
+// PoisonPolicy moves messages which keep failing to a parking entity,
+// instead of unlocking them until the broker dead-letters them.
+type PoisonPolicy struct {
+	maxDeliveries int
+	parking       Sender
+	onPoison      func(message *Message, reason error)
+}
+
+// NewPoisonPolicy creates a PoisonPolicy treating messages as poison
+// when handling them fails on delivery maxDeliveries or later, and
+// parking them by sending a copy through the parking Sender
+func NewPoisonPolicy(maxDeliveries int, parking Sender, opts ...PoisonPolicyOption) *PoisonPolicy {
+	p := &PoisonPolicy{
+		maxDeliveries: maxDeliveries,
+		parking:       parking,
+		onPoison:      func(message *Message, reason error) {},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// IsPoison reports whether the message has reached
+// the maximum number of deliveries
+func (p *PoisonPolicy) IsPoison(message *Message) bool {
+	return message.DeliveryCount >= p.maxDeliveries
+}
+
+// Park sends a copy of the message, with properties describing the
+// failure, to the parking entity and deletes the original through the
+// settler. The original is left locked when parking fails, and may be
+// parked twice when deleting it fails.
+func (p *PoisonPolicy) Park(ctx context.Context, settler Settler, message *Message, reason error) error {
+	parked := message.clone()
+	parked.ScheduledEnqueueTimeUtc = dateTime{}
+	if parked.Properties == nil {
+		parked.Properties = Properties{}
+	}
+	if reason != nil {
+		parked.Properties[PoisonReasonProperty] = reason.Error()
+	}
+	parked.Properties[PoisonDeliveryCountProperty] = int64(message.DeliveryCount)
+	parked.Properties[PoisonParkedAtProperty] = time.Now().UTC()
+	if source := entityPathFromLocation(message.Location); source != "" {
+		parked.Properties[PoisonSourceProperty] = source
+	}
+
+	if err := p.parking.SendContext(ctx, parked); err != nil {
+		return err
+	}
+
+	p.onPoison(message, reason)
+
+	return settler.DeleteMessageContext(ctx, message)
+}
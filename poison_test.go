@@ -0,0 +1,153 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoisonPolicyParksMessage(t *testing.T) {
+	consumer := newMemoryConsumer()
+	parking := &recordingSender{}
+
+	var poisoned *Message
+	policy := NewPoisonPolicy(3, parking, WithPoisonCallback(func(message *Message, reason error) {
+		poisoned = message
+	}))
+
+	message := &Message{
+		MessageID:     "id",
+		DeliveryCount: 3,
+		Location:      "https://test.servicebus.windows.net/orders/messages/1/lock",
+		Properties:    Properties{"Kind": "order"},
+		Body:          []byte("body"),
+	}
+
+	if policy.IsPoison(&Message{DeliveryCount: 2}) {
+		t.Errorf("Message below the threshold was treated as poison.")
+	}
+	if !policy.IsPoison(message) {
+		t.Errorf("Message at the threshold was not treated as poison.")
+	}
+
+	if err := policy.Park(context.Background(), consumer, message, errors.New("bad order")); err != nil {
+		t.Fatalf("Could not park message: %v", err)
+	}
+
+	if parking.count() != 1 {
+		t.Fatalf("Parked %d messages, expected 1.", parking.count())
+	}
+	parked := parking.sent[0]
+	if parked.MessageID != "id" || string(parked.Body) != "body" {
+		t.Errorf("Parked message is not a copy of the original.")
+	}
+	if reason, _ := parked.Properties.String(PoisonReasonProperty); reason != "bad order" {
+		t.Errorf("Parked message has reason %q, expected \"bad order\".", reason)
+	}
+	if source, _ := parked.Properties.String(PoisonSourceProperty); source != "orders" {
+		t.Errorf("Parked message has source %q, expected \"orders\".", source)
+	}
+	if count, _ := parked.Properties.Int64(PoisonDeliveryCountProperty); count != 3 {
+		t.Errorf("Parked message has delivery count %d, expected 3.", count)
+	}
+	if _, ok := message.Properties[PoisonReasonProperty]; ok {
+		t.Errorf("Original message was modified.")
+	}
+
+	if poisoned != message {
+		t.Errorf("Poison callback was not called.")
+	}
+	if deleted, _ := consumer.settled(); deleted != 1 {
+		t.Errorf("Original message was not deleted.")
+	}
+}
+
+func TestPoisonPolicyKeepsMessageWhenParkingFails(t *testing.T) {
+	consumer := newMemoryConsumer()
+	policy := NewPoisonPolicy(1, &recordingSender{})
+
+	err := policy.Park(context.Background(), consumer, &Message{DeliveryCount: 1, Body: []byte("fail")}, nil)
+	if !errors.Is(err, ErrThrottled) {
+		t.Errorf("Park returned %v, expected ErrThrottled.", err)
+	}
+	if deleted, _ := consumer.settled(); deleted != 0 {
+		t.Errorf("Message was deleted although parking failed.")
+	}
+}
+
+func TestProcessorParksPoisonMessages(t *testing.T) {
+	consumer := newMemoryConsumer(
+		&Message{DeliveryCount: 1, Body: []byte("first")},
+		&Message{DeliveryCount: 5, Body: []byte("last")},
+	)
+	parking := &recordingSender{}
+	processor := NewProcessor(consumer, func(ctx context.Context, message *Message) error {
+		return errors.New("handler failed")
+	}, WithReceiveTimeout(1), WithPoisonPolicy(NewPoisonPolicy(5, parking)))
+
+	processor.Start(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if deleted, unlocked := consumer.settled(); deleted+unlocked == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	processor.Stop(context.Background())
+
+	deleted, unlocked := consumer.settled()
+	if deleted != 1 || unlocked != 1 {
+		t.Errorf("Processor deleted %d and unlocked %d messages, expected 1 and 1.", deleted, unlocked)
+	}
+	if parking.count() != 1 || string(parking.sent[0].Body) != "last" {
+		t.Errorf("Processor did not park the poison message.")
+	}
+}
+
+// undecryptableConsumer is a memoryConsumer whose messages
+// are received along with an interceptor error
+type undecryptableConsumer struct {
+	*memoryConsumer
+}
+
+func (c *undecryptableConsumer) PeekLockMessageContext(ctx context.Context, timeout int) (*Message, error) {
+	msg, err := c.memoryConsumer.PeekLockMessageContext(ctx, timeout)
+	if msg != nil {
+		return msg, ErrDecryptionFailed
+	}
+	return msg, err
+}
+
+func TestProcessorParksPoisonMessagesFailingToReceive(t *testing.T) {
+	consumer := &undecryptableConsumer{newMemoryConsumer(
+		&Message{DeliveryCount: 1, Body: []byte("first")},
+		&Message{DeliveryCount: 5, Body: []byte("last")},
+	)}
+	parking := &recordingSender{}
+	processor := NewProcessor(consumer, func(ctx context.Context, message *Message) error {
+		t.Errorf("Handler was called with a message which failed to be received.")
+		return nil
+	}, WithReceiveTimeout(1), WithPoisonPolicy(NewPoisonPolicy(5, parking)))
+
+	processor.Start(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if deleted, unlocked := consumer.settled(); deleted+unlocked == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	processor.Stop(context.Background())
+
+	deleted, unlocked := consumer.settled()
+	if deleted != 1 || unlocked != 1 {
+		t.Errorf("Processor deleted %d and unlocked %d messages, expected 1 and 1.", deleted, unlocked)
+	}
+	if parking.count() != 1 || string(parking.sent[0].Body) != "last" {
+		t.Fatalf("Processor did not park the poison message.")
+	}
+	if reason, _ := parking.sent[0].Properties.String(PoisonReasonProperty); reason != ErrDecryptionFailed.Error() {
+		t.Errorf("Parked message has reason %q, expected the receive error.", reason)
+	}
+}
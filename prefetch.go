@@ -0,0 +1,253 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReceiverClosed is returned when receiving from a
+// receiver which has been closed
+var ErrReceiverClosed = errors.New("Receiver is closed")
+
+const (
+	defaultPrefetchCount      = 10
+	defaultPrefetchTimeout    = 30
+	defaultPrefetchLockMargin = 2 * time.Second
+	prefetchRetryDelay        = time.Second
+)
+
+// PrefetchOption configures a PrefetchReceiver
+type PrefetchOption func(*PrefetchReceiver)
+
+// WithPrefetchCount sets how many messages are buffered at most
+func WithPrefetchCount(count int) PrefetchOption {
+	return func(p *PrefetchReceiver) {
+		p.count = count
+	}
+}
+
+// WithPrefetchTimeout sets how long, in seconds, every
+// background poll waits for a message
+func WithPrefetchTimeout(timeout int) PrefetchOption {
+	return func(p *PrefetchReceiver) {
+		p.pollTimeout = timeout
+	}
+}
+
+// WithPrefetchLockMargin sets how long the lock of a buffered message
+// must at least remain valid for the message to be handed out
+func WithPrefetchLockMargin(margin time.Duration) PrefetchOption {
+	return func(p *PrefetchReceiver) {
+		p.lockMargin = margin
+	}
+}
+
+// PrefetchReceiver is a Consumer which peek-locks messages in the
+// background into a bounded buffer, so receiving a message does not
+// wait on a round-trip to the service. Buffered messages whose lock
+// has expired, or is about to, are unlocked instead of handed out.
+// Settling messages is passed through to the underlying Consumer.
+type PrefetchReceiver struct {
+	Settler
+
+	consumer    Consumer
+	count       int
+	pollTimeout int
+	lockMargin  time.Duration
+
+	buffer   chan *Message
+	errs     chan error
+	cancel   context.CancelFunc
+	closed   chan struct{}
+	done     chan struct{}
+	leftover *Message
+	once     sync.Once
+}
+
+// NewPrefetchReceiver creates a PrefetchReceiver and starts
+// prefetching messages from the consumer
+func NewPrefetchReceiver(consumer Consumer, opts ...PrefetchOption) *PrefetchReceiver {
+	p := &PrefetchReceiver{
+		Settler:     consumer,
+		consumer:    consumer,
+		count:       defaultPrefetchCount,
+		pollTimeout: defaultPrefetchTimeout,
+		lockMargin:  defaultPrefetchLockMargin,
+		errs:        make(chan error, 1),
+		closed:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.buffer = make(chan *Message, p.count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+
+	return p
+}
+
+// Depth returns the number of messages in the buffer
+func (p *PrefetchReceiver) Depth() int {
+	return len(p.buffer)
+}
+
+// PeekLockMessage returns the next buffered message, waiting
+// at most timeout seconds for one to be prefetched
+func (p *PrefetchReceiver) PeekLockMessage(timeout int) (*Message, error) {
+	return p.PeekLockMessageContext(context.Background(), timeout)
+}
+
+// PeekLockMessageContext returns the next buffered message, waiting
+// at most timeout seconds for one to be prefetched
+func (p *PrefetchReceiver) PeekLockMessageContext(ctx context.Context, timeout int) (*Message, error) {
+	timer := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+
+	for {
+		msg, err := p.next(ctx, timer.C)
+		if msg == nil || err != nil {
+			return msg, err
+		}
+
+		if p.expired(msg) {
+			// The lock is lost anyway if unlocking fails
+			p.consumer.UnlockContext(ctx, msg)
+			continue
+		}
+
+		return msg, nil
+	}
+}
+
+// DestructiveRead returns and deletes the next buffered message,
+// waiting at most timeout seconds for one to be prefetched
+func (p *PrefetchReceiver) DestructiveRead(timeout int) (*Message, error) {
+	return p.DestructiveReadContext(context.Background(), timeout)
+}
+
+// DestructiveReadContext returns and deletes the next buffered message,
+// waiting at most timeout seconds for one to be prefetched
+func (p *PrefetchReceiver) DestructiveReadContext(ctx context.Context, timeout int) (*Message, error) {
+	msg, err := p.PeekLockMessageContext(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, ErrNoMessage
+	}
+
+	if err := p.consumer.DeleteMessageContext(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// Close stops prefetching and unlocks the buffered messages
+func (p *PrefetchReceiver) Close(ctx context.Context) error {
+	p.once.Do(func() {
+		close(p.closed)
+		p.cancel()
+	})
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var firstErr error
+	unlock := func(msg *Message) {
+		if err := p.consumer.UnlockContext(ctx, msg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if p.leftover != nil {
+		unlock(p.leftover)
+		p.leftover = nil
+	}
+
+	for {
+		select {
+		case msg := <-p.buffer:
+			unlock(msg)
+		default:
+			return firstErr
+		}
+	}
+}
+
+// next takes a message from the buffer, preferring buffered
+// messages over errors from the background polls
+func (p *PrefetchReceiver) next(ctx context.Context, timeout <-chan time.Time) (*Message, error) {
+	select {
+	case msg := <-p.buffer:
+		return msg, nil
+	default:
+	}
+
+	select {
+	case msg := <-p.buffer:
+		return msg, nil
+	case err := <-p.errs:
+		return nil, err
+	case <-p.closed:
+		return nil, ErrReceiverClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, nil
+	}
+}
+
+func (p *PrefetchReceiver) expired(msg *Message) bool {
+	lockedUntil := msg.LockedUntilUtc.Time
+	return !lockedUntil.IsZero() && time.Now().Add(p.lockMargin).After(lockedUntil)
+}
+
+func (p *PrefetchReceiver) run(ctx context.Context) {
+	defer close(p.done)
+
+	for {
+		msg, err := p.consumer.PeekLockMessageContext(ctx, p.pollTimeout)
+		if ctx.Err() != nil {
+			p.leftover = msg
+			return
+		}
+		if err != nil {
+			if msg != nil {
+				p.consumer.UnlockContext(ctx, msg)
+			}
+
+			select {
+			case p.errs <- err:
+			default:
+			}
+
+			select {
+			case <-time.After(prefetchRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		select {
+		case p.buffer <- msg:
+		case <-ctx.Done():
+			p.leftover = msg
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package azureservicebus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPrefetchReceiverBuffersMessages(t *testing.T) {
+	consumer := newMemoryConsumer(
+		lockedMessage(time.Minute),
+		lockedMessage(time.Minute),
+		lockedMessage(time.Minute),
+	)
+	p := NewPrefetchReceiver(consumer, WithPrefetchCount(2), WithPrefetchTimeout(1))
+	defer p.Close(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	for p.Depth() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p.Depth() != 2 {
+		t.Fatalf("Buffer depth is %d, expected 2.", p.Depth())
+	}
+
+	for i := 0; i < 3; i++ {
+		msg, err := p.PeekLockMessage(1)
+		if err != nil || msg == nil {
+			t.Fatalf("Could not receive message %d: %v", i, err)
+		}
+	}
+
+	msg, err := p.PeekLockMessage(0)
+	if msg != nil || err != nil {
+		t.Errorf("Received a message from an empty receiver.")
+	}
+}
+
+func TestPrefetchReceiverUnlocksExpiredMessages(t *testing.T) {
+	expired := lockedMessage(time.Second)
+	valid := lockedMessage(time.Minute)
+	consumer := newMemoryConsumer(expired, valid)
+	p := NewPrefetchReceiver(consumer, WithPrefetchTimeout(1), WithPrefetchLockMargin(5*time.Second))
+	defer p.Close(context.Background())
+
+	msg, err := p.PeekLockMessage(1)
+	if err != nil {
+		t.Fatalf("Could not receive message: %v", err)
+	}
+	if msg != valid {
+		t.Errorf("Message with an expired lock was handed out.")
+	}
+	if _, unlocked := consumer.settled(); unlocked != 1 {
+		t.Errorf("Message with an expired lock was not unlocked.")
+	}
+}
+
+func TestPrefetchReceiverCloseUnlocksBuffer(t *testing.T) {
+	consumer := newMemoryConsumer(lockedMessage(time.Minute), lockedMessage(time.Minute))
+	p := NewPrefetchReceiver(consumer, WithPrefetchTimeout(1))
+
+	deadline := time.Now().Add(time.Second)
+	for p.Depth() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Errorf("Could not close receiver: %v", err)
+	}
+	if _, unlocked := consumer.settled(); unlocked != 2 {
+		t.Errorf("Buffered messages were not unlocked on close.")
+	}
+	if _, err := p.PeekLockMessage(1); err != ErrReceiverClosed {
+		t.Errorf("Closed receiver returned %v, expected ErrReceiverClosed.", err)
+	}
+}
@@ -0,0 +1,266 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrHandlerPanic is reported when a handler panics
+	ErrHandlerPanic = errors.New("Handler panicked")
+	// ErrProcessorStarted is returned when starting a running Processor
+	ErrProcessorStarted = errors.New("Processor is already started")
+)
+
+const (
+	defaultProcessorConcurrency    = 1
+	defaultProcessorReceiveTimeout = 30
+	processorRetryDelay            = time.Second
+)
+
+// Handler processes a received message. Returning nil deletes the
+// message, returning an error unlocks it for re-processing.
+type Handler func(ctx context.Context, message *Message) error
+
+// ProcessorOption configures a Processor
+type ProcessorOption func(*Processor)
+
+// WithConcurrency sets the number of concurrent receive loops,
+// each handling one message at a time
+func WithConcurrency(concurrency int) ProcessorOption {
+	return func(p *Processor) {
+		p.concurrency = concurrency
+	}
+}
+
+// WithReceiveTimeout sets how long, in seconds, every receive
+// waits for a message
+func WithReceiveTimeout(timeout int) ProcessorOption {
+	return func(p *Processor) {
+		p.receiveTimeout = timeout
+	}
+}
+
+// WithErrorHandler sets a function called with every error from
+// receiving, handling or settling; message is nil for receive errors
+func WithErrorHandler(onError func(message *Message, err error)) ProcessorOption {
+	return func(p *Processor) {
+		p.onError = onError
+	}
+}
+
+// WithAutoLockRenewal renews the lock of every message while it is
+// being handled, for at most maxDuration
+func WithAutoLockRenewal(maxDuration time.Duration) ProcessorOption {
+	return func(p *Processor) {
+		p.maxRenewalDuration = maxDuration
+	}
+}
+
+// WithPoisonPolicy parks messages with the policy when handling
+// them fails and they have reached its maximum number of deliveries
+func WithPoisonPolicy(policy *PoisonPolicy) ProcessorOption {
+	return func(p *Processor) {
+		p.poison = policy
+	}
+}
+
+// Processor receives messages with peek-lock from a Consumer and
+// passes them to a Handler, deleting messages which were handled and
+// unlocking messages which failed or made the handler panic.
+type Processor struct {
+	consumer       Consumer
+	handler        Handler
+	concurrency    int
+	receiveTimeout int
+	onError        func(message *Message, err error)
+
+	maxRenewalDuration time.Duration
+	renewer            *LockRenewer
+	poison             *PoisonPolicy
+
+	mu            sync.Mutex
+	running       bool
+	stopReceiving context.CancelFunc
+	stopHandling  context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+// NewProcessor creates a Processor passing messages from
+// the consumer to the handler
+func NewProcessor(consumer Consumer, handler Handler, opts ...ProcessorOption) *Processor {
+	p := &Processor{
+		consumer:       consumer,
+		handler:        handler,
+		concurrency:    defaultProcessorConcurrency,
+		receiveTimeout: defaultProcessorReceiveTimeout,
+		onError:        func(message *Message, err error) {},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.maxRenewalDuration > 0 {
+		p.renewer = NewLockRenewer(consumer,
+			WithMaxRenewalDuration(p.maxRenewalDuration),
+			WithRenewalErrorHandler(p.onError))
+	}
+
+	return p
+}
+
+// Start starts the receive loops. Handlers get a context derived from
+// ctx, which is only cancelled when Stop gives up waiting for them.
+func (p *Processor) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running {
+		return ErrProcessorStarted
+	}
+
+	handleCtx, stopHandling := context.WithCancel(ctx)
+	receiveCtx, stopReceiving := context.WithCancel(handleCtx)
+
+	p.running = true
+	p.stopReceiving = stopReceiving
+	p.stopHandling = stopHandling
+
+	for i := 0; i < p.concurrency; i++ {
+		p.wg.Add(1)
+		go p.receive(receiveCtx, handleCtx)
+	}
+
+	return nil
+}
+
+// Stop stops receiving new messages and waits for the messages being
+// handled to be settled. When ctx is done first, the handler contexts
+// are cancelled and ctx.Err() is returned right away, leaving handlers
+// which ignore their context running in the background.
+func (p *Processor) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return nil
+	}
+	p.running = false
+	stopReceiving, stopHandling := p.stopReceiving, p.stopHandling
+	p.mu.Unlock()
+
+	stopReceiving()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		stopHandling()
+		return nil
+	case <-ctx.Done():
+		stopHandling()
+		return ctx.Err()
+	}
+}
+
+func (p *Processor) receive(receiveCtx context.Context, handleCtx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		msg, err := p.consumer.PeekLockMessageContext(receiveCtx, p.receiveTimeout)
+		if receiveCtx.Err() != nil {
+			if msg != nil {
+				p.unlock(handleCtx, msg)
+			}
+			return
+		}
+		if err != nil {
+			p.onError(msg, err)
+			// The message was received, but an interceptor failed on it
+			if msg != nil {
+				p.release(handleCtx, msg, err)
+				continue
+			}
+
+			select {
+			case <-time.After(processorRetryDelay):
+			case <-receiveCtx.Done():
+				return
+			}
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		p.process(handleCtx, msg)
+	}
+}
+
+func (p *Processor) process(ctx context.Context, msg *Message) {
+	if err := p.handle(ctx, msg); err != nil {
+		p.onError(msg, err)
+		p.release(ctx, msg, err)
+		return
+	}
+
+	if err := p.consumer.DeleteMessageContext(ctx, msg); err != nil {
+		p.onError(msg, err)
+	}
+}
+
+// handle invokes the handler, renewing the message lock meanwhile
+// when auto lock renewal is enabled
+func (p *Processor) handle(ctx context.Context, msg *Message) error {
+	if p.renewer == nil {
+		return p.invoke(ctx, msg)
+	}
+
+	handleCtx, stopRenewal := p.renewer.Renew(ctx, msg)
+	defer stopRenewal()
+
+	return p.invoke(handleCtx, msg)
+}
+
+// invoke calls the handler, turning a panic into an error
+func (p *Processor) invoke(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+		}
+	}()
+
+	return p.handler(ctx, msg)
+}
+
+// release unlocks a message which failed, or parks it when
+// it is poison according to the poison policy
+func (p *Processor) release(ctx context.Context, msg *Message, reason error) {
+	if p.poison != nil && p.poison.IsPoison(msg) {
+		p.park(ctx, msg, reason)
+		return
+	}
+	p.unlock(ctx, msg)
+}
+
+// park moves a poison message to the parking entity,
+// unlocking it when that fails
+func (p *Processor) park(ctx context.Context, msg *Message, reason error) {
+	if err := p.poison.Park(ctx, p.consumer, msg, reason); err != nil {
+		p.onError(msg, err)
+		p.unlock(ctx, msg)
+	}
+}
+
+func (p *Processor) unlock(ctx context.Context, msg *Message) {
+	if err := p.consumer.UnlockContext(ctx, msg); err != nil {
+		p.onError(msg, err)
+	}
+}
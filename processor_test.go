@@ -0,0 +1,208 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryConsumer is a Consumer handing out queued messages,
+// recording how they were settled
+type memoryConsumer struct {
+	mu       sync.Mutex
+	messages chan *Message
+	deleted  []*Message
+	unlocked []*Message
+	renewed  int
+	renewErr error
+}
+
+func newMemoryConsumer(messages ...*Message) *memoryConsumer {
+	c := &memoryConsumer{messages: make(chan *Message, 100)}
+	for _, message := range messages {
+		c.messages <- message
+	}
+	return c
+}
+
+func (c *memoryConsumer) PeekLockMessage(timeout int) (*Message, error) {
+	return c.PeekLockMessageContext(context.Background(), timeout)
+}
+
+func (c *memoryConsumer) PeekLockMessageContext(ctx context.Context, timeout int) (*Message, error) {
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *memoryConsumer) DestructiveRead(timeout int) (*Message, error) {
+	return c.DestructiveReadContext(context.Background(), timeout)
+}
+
+func (c *memoryConsumer) DestructiveReadContext(ctx context.Context, timeout int) (*Message, error) {
+	msg, err := c.PeekLockMessageContext(ctx, timeout)
+	if err == nil && msg == nil {
+		return nil, ErrNoMessage
+	}
+	return msg, err
+}
+
+func (c *memoryConsumer) Unlock(message *Message) error {
+	return c.UnlockContext(context.Background(), message)
+}
+
+func (c *memoryConsumer) UnlockContext(ctx context.Context, message *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.unlocked = append(c.unlocked, message)
+	return nil
+}
+
+func (c *memoryConsumer) RenewLock(message *Message) error {
+	return c.RenewLockContext(context.Background(), message)
+}
+
+func (c *memoryConsumer) RenewLockContext(ctx context.Context, message *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.renewed++
+	return c.renewErr
+}
+
+func (c *memoryConsumer) DeleteMessage(message *Message) error {
+	return c.DeleteMessageContext(context.Background(), message)
+}
+
+func (c *memoryConsumer) DeleteMessageContext(ctx context.Context, message *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deleted = append(c.deleted, message)
+	return nil
+}
+
+func (c *memoryConsumer) settled() (deleted int, unlocked int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.deleted), len(c.unlocked)
+}
+
+func TestProcessorSettlesMessages(t *testing.T) {
+	consumer := newMemoryConsumer(
+		&Message{Body: []byte("ok")},
+		&Message{Body: []byte("fail")},
+		&Message{Body: []byte("panic")},
+	)
+
+	var mu sync.Mutex
+	var errs []error
+	processor := NewProcessor(consumer, func(ctx context.Context, message *Message) error {
+		switch string(message.Body) {
+		case "fail":
+			return errors.New("handler failed")
+		case "panic":
+			panic("handler panicked")
+		}
+		return nil
+	}, WithConcurrency(3), WithReceiveTimeout(1), WithErrorHandler(func(message *Message, err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}))
+
+	if err := processor.Start(context.Background()); err != nil {
+		t.Fatalf("Could not start processor: %v", err)
+	}
+	if err := processor.Start(context.Background()); err != ErrProcessorStarted {
+		t.Errorf("Processor was started twice.")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if deleted, unlocked := consumer.settled(); deleted+unlocked == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := processor.Stop(context.Background()); err != nil {
+		t.Errorf("Could not stop processor: %v", err)
+	}
+
+	deleted, unlocked := consumer.settled()
+	if deleted != 1 || unlocked != 2 {
+		t.Errorf("Processor deleted %d and unlocked %d messages, expected 1 and 2.", deleted, unlocked)
+	}
+
+	panicked := false
+	for _, err := range errs {
+		if errors.Is(err, ErrHandlerPanic) {
+			panicked = true
+		}
+	}
+	if !panicked {
+		t.Errorf("Handler panic was not reported.")
+	}
+}
+
+func TestProcessorStopDrainsHandlers(t *testing.T) {
+	consumer := newMemoryConsumer(&Message{Body: []byte("slow")})
+	started := make(chan struct{})
+	processor := NewProcessor(consumer, func(ctx context.Context, message *Message) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		return ctx.Err()
+	}, WithReceiveTimeout(1))
+
+	processor.Start(context.Background())
+	<-started
+
+	if err := processor.Stop(context.Background()); err != nil {
+		t.Errorf("Could not stop processor: %v", err)
+	}
+	if deleted, _ := consumer.settled(); deleted != 1 {
+		t.Errorf("Message being handled was not settled before Stop returned.")
+	}
+}
+
+func TestProcessorStopWithStuckHandler(t *testing.T) {
+	consumer := newMemoryConsumer(&Message{Body: []byte("stuck")})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	processor := NewProcessor(consumer, func(ctx context.Context, message *Message) error {
+		close(started)
+		<-release
+		return nil
+	}, WithReceiveTimeout(1))
+
+	processor.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- processor.Stop(ctx)
+	}()
+
+	select {
+	case err := <-stopped:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Stop returned %v, expected context.DeadlineExceeded.", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Stop did not return when its context was done.")
+	}
+}
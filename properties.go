@@ -0,0 +1,195 @@
+package azureservicebus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Properties holds the custom (user) properties of a message. Values
+// are typed as string, int64, float64, bool or time.Time, and are encoded
+// according to the Azure Service Bus REST protocol; strings and dates
+// are quoted, numbers and booleans are not.
+//
+// Properties are sent as HTTP headers, so the original casing of their
+// keys cannot be preserved: received keys are lowercased. Look them up
+// with Get or the typed getters, which match keys case-insensitively.
+type Properties map[string]interface{}
+
+// Get returns the value of a property, matching the key
+// case-insensitively when there is no exact match
+func (p Properties) Get(key string) (interface{}, bool) {
+	if value, ok := p[key]; ok {
+		return value, true
+	}
+
+	for k, value := range p {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// String returns the value of a string property
+func (p Properties) String(key string) (string, bool) {
+	value, ok := p.Get(key)
+	if !ok {
+		return "", false
+	}
+
+	s, ok := value.(string)
+	return s, ok
+}
+
+// Int64 returns the value of an integer property
+func (p Properties) Int64(key string) (int64, bool) {
+	value, ok := p.Get(key)
+	if !ok {
+		return 0, false
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	}
+
+	return 0, false
+}
+
+// Float64 returns the value of a numeric property
+func (p Properties) Float64(key string) (float64, bool) {
+	value, ok := p.Get(key)
+	if !ok {
+		return 0, false
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+
+	if i, ok := p.Int64(key); ok {
+		return float64(i), true
+	}
+
+	return 0, false
+}
+
+// Bool returns the value of a boolean property
+func (p Properties) Bool(key string) (bool, bool) {
+	value, ok := p.Get(key)
+	if !ok {
+		return false, false
+	}
+
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// Time returns the value of a date property
+func (p Properties) Time(key string) (time.Time, bool) {
+	value, ok := p.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, ok := value.(time.Time)
+	return t, ok
+}
+
+// encodePropertyValue formats a property value as a HTTP header value
+func encodePropertyValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		data, err := json.Marshal(v)
+		return string(data), err
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float32:
+		return formatFloat(float64(v)), nil
+	case float64:
+		return formatFloat(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return strconv.Quote(v.UTC().Format(http.TimeFormat)), nil
+	}
+
+	return "", fmt.Errorf("%w: unsupported property type %T", ErrInvalidMessage, value)
+}
+
+// formatFloat always includes a decimal point or exponent, so
+// the value is not decoded as an integer by the receiver
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// decodePropertyValue parses a HTTP header value into a typed
+// property value
+func decodePropertyValue(value string) interface{} {
+	value = strings.TrimSpace(value)
+
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		var s string
+		if err := json.Unmarshal([]byte(value), &s); err != nil {
+			s = value[1 : len(value)-1]
+		}
+		if t, err := time.Parse(http.TimeFormat, s); err == nil {
+			return t
+		}
+		return s
+	}
+
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+
+	return value
+}
+
+// batchPropertyValues converts the properties to values for the
+// UserProperties object of the JSON batch format
+func (p Properties) batchPropertyValues() (map[string]interface{}, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+
+	values := make(map[string]interface{}, len(p))
+	for key, value := range p {
+		switch v := value.(type) {
+		case string, int, int32, int64, float32, float64, bool:
+			values[key] = v
+		case time.Time:
+			values[key] = v.UTC().Format(http.TimeFormat)
+		default:
+			return nil, fmt.Errorf("%w: unsupported property type %T", ErrInvalidMessage, value)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,103 @@
+package azureservicebus
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodePropertyValue(t *testing.T) {
+	date := time.Date(2018, 1, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"text", `"text"`},
+		{int64(42), "42"},
+		{2.5, "2.5"},
+		{2.0, "2.0"},
+		{true, "true"},
+		{date, `"Wed, 10 Jan 2018 12:00:00 GMT"`},
+	}
+
+	for _, c := range cases {
+		encoded, err := encodePropertyValue(c.value)
+		if err != nil {
+			t.Errorf("Could not encode property value %v.", c.value)
+		}
+		if encoded != c.expected {
+			t.Errorf("Property value %v was encoded as %s, expected %s.", c.value, encoded, c.expected)
+		}
+	}
+
+	if _, err := encodePropertyValue(struct{}{}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Unsupported property type was encoded.")
+	}
+}
+
+func TestDecodePropertyValue(t *testing.T) {
+	date := time.Date(2018, 1, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{`"text"`, "text"},
+		{`"42"`, "42"},
+		{"42", int64(42)},
+		{"2.5", 2.5},
+		{"2.0", 2.0},
+		{"false", false},
+		{`"Wed, 10 Jan 2018 12:00:00 GMT"`, date},
+		{"unquoted", "unquoted"},
+	}
+
+	for _, c := range cases {
+		decoded := decodePropertyValue(c.value)
+		if t1, ok := c.expected.(time.Time); ok {
+			if t2, ok := decoded.(time.Time); !ok || !t1.Equal(t2) {
+				t.Errorf("Property value %s was decoded as %v.", c.value, decoded)
+			}
+			continue
+		}
+		if decoded != c.expected {
+			t.Errorf("Property value %s was decoded as %v (%T).", c.value, decoded, decoded)
+		}
+	}
+}
+
+func TestResponseToMessageTypedProperties(t *testing.T) {
+	resp := &http.Response{
+		Header: http.Header{
+			"Brokerproperties": {`{"MessageId":"test-id"}`},
+			"Content-Length":   {"9"},
+			"Ordernumber":      {"1234"},
+			"Customer":         {`"ACME"`},
+			"Priority":         {"true"},
+		},
+		Body: ioutil.NopCloser(strings.NewReader("test-body")),
+	}
+
+	msg, err := ResponseToMessage(resp)
+	if err != nil {
+		t.Fatalf("Could not read message from response: %v", err)
+	}
+
+	if n, ok := msg.Properties.Int64("OrderNumber"); !ok || n != 1234 {
+		t.Errorf("Integer property was not decoded.")
+	}
+	if s, ok := msg.Properties.String("customer"); !ok || s != "ACME" {
+		t.Errorf("String property was not decoded.")
+	}
+	if b, ok := msg.Properties.Bool("Priority"); !ok || !b {
+		t.Errorf("Boolean property was not decoded.")
+	}
+	if _, ok := msg.Properties.Get("Content-Length"); ok {
+		t.Errorf("Transport header was read as a custom property.")
+	}
+	if _, ok := msg.Properties["ordernumber"]; !ok {
+		t.Errorf("Received property key was not lowercased.")
+	}
+}
@@ -0,0 +1,93 @@
+package azureservicebus
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRetryMinBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+// RetryPolicy retries requests which were throttled (429 or 503), or
+// failed without a response from the service. The backoff doubles from
+// MinBackoff up to MaxBackoff, and is extended to the Retry-After of a
+// throttled response, up to MaxBackoff. A retried send can be stored twice when only the
+// response was lost, which duplicate detection on the entity prevents.
+type RetryPolicy struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// WithRetryPolicy retries failed requests of every client
+// sharing the HTTPRequestClient according to the policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(hrc *HTTPRequestClient) {
+		if policy.MinBackoff <= 0 {
+			policy.MinBackoff = defaultRetryMinBackoff
+		}
+		if policy.MaxBackoff <= 0 {
+			policy.MaxBackoff = defaultRetryMaxBackoff
+		}
+		hrc.retryPolicy = policy
+	}
+}
+
+// backoff returns how long to wait before retry number attempt,
+// or false when the request should not be retried
+func (p RetryPolicy) backoff(ctx context.Context, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxRetries || ctx.Err() != nil {
+		return 0, false
+	}
+
+	var retryAfter time.Duration
+	if err == nil {
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return 0, false
+		}
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	backoff := p.MinBackoff
+	for i := 0; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if retryAfter > backoff {
+		backoff = retryAfter
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	return backoff, true
+}
+
+// retry prepares a request to be sent again after the backoff,
+// discarding the response of the failed attempt
+func retry(ctx context.Context, req *http.Request, resp *http.Response, backoff time.Duration) error {
+	if resp != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	select {
+	case <-time.After(backoff):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		req.Body = body
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyRetriesThrottledRequests(t *testing.T) {
+	var bodies []string
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	WithRetryPolicy(RetryPolicy{MaxRetries: 3, MinBackoff: 10 * time.Millisecond})(hrc)
+
+	if err := newSender(hrc, "test-queue").Send(&Message{Body: []byte("test-body")}); err != nil {
+		t.Fatalf("Throttled send was not retried: %v", err)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("Send was attempted %d times, expected 3.", len(bodies))
+	}
+	for _, body := range bodies {
+		if body != "test-body" {
+			t.Errorf("Retried request did not resend the body.")
+		}
+	}
+}
+
+func TestRetryPolicyHonorsRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, MinBackoff: 10 * time.Millisecond, MaxBackoff: time.Minute}
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"2"}},
+	}
+
+	if backoff, ok := policy.backoff(context.Background(), 0, resp, nil); !ok || backoff != 2*time.Second {
+		t.Errorf("Backoff was %s, expected the Retry-After of 2s.", backoff)
+	}
+
+	policy.MaxBackoff = time.Second
+	if backoff, _ := policy.backoff(context.Background(), 0, resp, nil); backoff != time.Second {
+		t.Errorf("Backoff was %s, expected Retry-After capped at 1s.", backoff)
+	}
+
+	if backoff, _ := policy.backoff(context.Background(), 2, nil, errors.New("connection reset")); backoff != 40*time.Millisecond {
+		t.Errorf("Backoff of the third attempt was %s, expected 40ms.", backoff)
+	}
+}
+
+func TestRetryPolicyRenewsAuthorization(t *testing.T) {
+	var hrc *HTTPRequestClient
+	var authorizations []string
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if len(authorizations) == 1 {
+			hrc.mu.Lock()
+			hrc.token = "renewed-token"
+			hrc.tokenExpiry = time.Now().Add(time.Hour)
+			hrc.mu.Unlock()
+
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	WithRetryPolicy(RetryPolicy{MaxRetries: 1, MinBackoff: 10 * time.Millisecond})(hrc)
+
+	if err := newSender(hrc, "test-queue").Send(&Message{Body: []byte("test-body")}); err != nil {
+		t.Fatalf("Throttled send was not retried: %v", err)
+	}
+	if len(authorizations) != 2 || authorizations[1] != "renewed-token" {
+		t.Errorf("Retried request did not use the renewed token.")
+	}
+}
+
+func TestRetryPolicyGivesUp(t *testing.T) {
+	attempts := 0
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer ts.Close()
+
+	sender := newSender(hrc, "test-queue")
+	if err := sender.Send(&Message{Body: []byte("test-body")}); !errors.Is(err, ErrThrottled) || attempts != 1 {
+		t.Errorf("Send without a retry policy was retried.")
+	}
+
+	attempts = 0
+	WithRetryPolicy(RetryPolicy{MaxRetries: 2, MinBackoff: 10 * time.Millisecond})(hrc)
+	if err := sender.Send(&Message{Body: []byte("test-body")}); !errors.Is(err, ErrThrottled) {
+		t.Errorf("Send returned %v after exhausting retries, expected ErrThrottled.", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Send was attempted %d times, expected 3.", attempts)
+	}
+}
+
+func TestRetryPolicyDoesNotRetryClientErrors(t *testing.T) {
+	attempts := 0
+	hrc, ts := newTestHTTPRequestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+	WithRetryPolicy(RetryPolicy{MaxRetries: 3, MinBackoff: 10 * time.Millisecond})(hrc)
+
+	if err := newSender(hrc, "test-queue").Send(&Message{Body: []byte("test-body")}); !errors.Is(err, ErrUnauthorized) || attempts != 1 {
+		t.Errorf("Unauthorized send was retried.")
+	}
+}
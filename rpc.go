@@ -0,0 +1,244 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRequesterClosed is returned by requests on a closed Requester
+	ErrRequesterClosed = errors.New("Requester is closed")
+	// ErrNoReplyTo is returned when replying to a message without ReplyTo
+	ErrNoReplyTo = errors.New("Message has no ReplyTo")
+)
+
+const (
+	defaultReplyPollTimeout = 30
+	replyRetryDelay         = time.Second
+)
+
+// RequesterOption configures a Requester
+type RequesterOption func(*Requester)
+
+// WithReplyPollTimeout sets how long, in seconds, every poll for
+// replies waits for a message
+func WithReplyPollTimeout(timeout int) RequesterOption {
+	return func(r *Requester) {
+		r.pollTimeout = timeout
+	}
+}
+
+// WithReplyErrorHandler sets a function called with every error from
+// receiving or deleting replies; message is nil for receive errors
+func WithReplyErrorHandler(onError func(message *Message, err error)) RequesterOption {
+	return func(r *Requester) {
+		r.onError = onError
+	}
+}
+
+// Requester implements request/reply over Azure Service Bus. Requests
+// are sent with ReplyTo set to the reply entity and a MessageId, and
+// replies are matched to pending requests by their CorrelationId.
+//
+// The reply entity should be a queue or subscription owned by this
+// instance only; replies to requests that have already timed out are
+// deleted. When receiving replies fails with an error retrying cannot
+// fix, such as ErrUnauthorized or ErrEntityNotFound, the Requester stops
+// listening and fails pending and later requests with that error.
+type Requester struct {
+	sender      Sender
+	replies     Consumer
+	replyTo     string
+	pollTimeout int
+	onError     func(message *Message, err error)
+
+	mu      sync.Mutex
+	pending map[string]chan *Message
+	closed  bool
+	err     error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRequester creates a Requester sending requests through sender,
+// and listening for replies on the replies consumer, which receives
+// from the entity named replyTo
+func NewRequester(sender Sender, replies Consumer, replyTo string, opts ...RequesterOption) *Requester {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Requester{
+		sender:      sender,
+		replies:     replies,
+		replyTo:     replyTo,
+		pollTimeout: defaultReplyPollTimeout,
+		onError:     func(message *Message, err error) {},
+		pending:     make(map[string]chan *Message),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	go r.listen(ctx)
+	return r
+}
+
+// Request sends a request and waits for its reply until the context
+// is done. When the context has a deadline and the message has no time
+// to live, the request expires at the deadline.
+func (r *Requester) Request(ctx context.Context, message *Message) (*Message, error) {
+	if message.MessageID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		message.MessageID = id
+	}
+	message.ReplyTo = r.replyTo
+
+	if deadline, ok := ctx.Deadline(); ok && message.TimeToLive == 0 {
+		if ttl := time.Until(deadline).Seconds(); ttl > 0 {
+			message.TimeToLive = ttl
+		}
+	}
+
+	reply := make(chan *Message, 1)
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRequesterClosed
+	}
+	if r.err != nil {
+		r.mu.Unlock()
+		return nil, r.err
+	}
+	r.pending[message.MessageID] = reply
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, message.MessageID)
+		r.mu.Unlock()
+	}()
+
+	if err := r.sender.SendContext(ctx, message); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-r.done:
+		return nil, r.stopped()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops listening for replies, failing pending requests
+func (r *Requester) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	r.cancel()
+	<-r.done
+	return nil
+}
+
+// stopped returns the error which stopped the Requester from listening
+func (r *Requester) stopped() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	return ErrRequesterClosed
+}
+
+func (r *Requester) listen(ctx context.Context) {
+	defer close(r.done)
+
+	for {
+		msg, err := r.replies.PeekLockMessageContext(ctx, r.pollTimeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.onError(msg, err)
+			if !retryableReceiveError(err) {
+				r.mu.Lock()
+				r.err = err
+				r.mu.Unlock()
+				return
+			}
+
+			select {
+			case <-time.After(replyRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		if err := r.replies.DeleteMessageContext(ctx, msg); err != nil {
+			r.onError(msg, err)
+		}
+
+		r.mu.Lock()
+		reply, ok := r.pending[msg.CorrelationID]
+		r.mu.Unlock()
+
+		if ok {
+			select {
+			case reply <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// Responder sends replies to requests received from a Requester
+type Responder struct {
+	ns *Namespace
+}
+
+// NewResponder creates a Responder sending replies through the
+// entities of the namespace
+func NewResponder(ns *Namespace) *Responder {
+	return &Responder{ns: ns}
+}
+
+// Reply sends a reply to the ReplyTo entity of the request, correlated
+// by the MessageId of the request
+func (r *Responder) Reply(ctx context.Context, request *Message, reply *Message) error {
+	if request.ReplyTo == "" {
+		return ErrNoReplyTo
+	}
+
+	reply.CorrelationID = request.MessageID
+	if request.ReplyToSessionID != "" {
+		reply.SessionID = request.ReplyToSessionID
+	}
+
+	return newSender(r.ns.client, replyEntityPath(request.ReplyTo)).SendContext(ctx, reply)
+}
+
+// replyEntityPath accepts ReplyTo as either an entity name or an
+// absolute entity URL
+func replyEntityPath(replyTo string) string {
+	if u, err := url.Parse(replyTo); err == nil && u.IsAbs() {
+		return strings.Trim(u.Path, "/")
+	}
+	return replyTo
+}
@@ -0,0 +1,109 @@
+package azureservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestReply(t *testing.T) {
+	requests, _, requestServer := newTestQueueNamespace(t)
+	defer requestServer.Close()
+	replies, _, replyServer := newTestQueueNamespace(t)
+	defer replyServer.Close()
+
+	requester := NewRequester(requests.QueueSender("requests"), replies.QueueReceiver("replies"), "replies", WithReplyPollTimeout(1))
+	defer requester.Close()
+
+	go func() {
+		incoming := requests.QueueReceiver("requests")
+		responder := NewResponder(replies)
+		for i := 0; i < 50; i++ {
+			msg, err := incoming.PeekLockMessage(1)
+			if err != nil || msg == nil {
+				continue
+			}
+			if msg.ReplyTo != "replies" {
+				t.Errorf("Request was not sent with ReplyTo.")
+			}
+			responder.Reply(context.Background(), msg, &Message{Body: append([]byte("re: "), msg.Body...)})
+			incoming.DeleteMessage(msg)
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	request := &Message{Body: []byte("ping")}
+	reply, err := requester.Request(ctx, request)
+	if err != nil {
+		t.Fatalf("Request did not get a reply: %v", err)
+	}
+	if string(reply.Body) != "re: ping" {
+		t.Errorf("Reply did not match the request.")
+	}
+	if reply.CorrelationID != request.MessageID {
+		t.Errorf("Reply was not correlated with the request.")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	requests, _, requestServer := newTestQueueNamespace(t)
+	defer requestServer.Close()
+	replies, _, replyServer := newTestQueueNamespace(t)
+	defer replyServer.Close()
+
+	requester := NewRequester(requests.QueueSender("requests"), replies.QueueReceiver("replies"), "replies", WithReplyPollTimeout(1))
+	defer requester.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	request := &Message{Body: []byte("ping")}
+	if _, err := requester.Request(ctx, request); err != context.DeadlineExceeded {
+		t.Errorf("Request without reply did not time out.")
+	}
+	if request.TimeToLive <= 0 {
+		t.Errorf("Request did not get a time to live from the context deadline.")
+	}
+}
+
+func TestReplyWithoutReplyTo(t *testing.T) {
+	ns, _, ts := newTestQueueNamespace(t)
+	defer ts.Close()
+
+	if err := NewResponder(ns).Reply(context.Background(), &Message{}, &Message{}); err != ErrNoReplyTo {
+		t.Errorf("Reply to a message without ReplyTo did not fail.")
+	}
+}
+
+func TestRequesterFailsOnUnauthorizedReplies(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	replies := &failingReceiver{memoryConsumer: newMemoryConsumer(), err: ErrUnauthorized, failures: -1}
+	requester := NewRequester(&recordingSender{}, replies, "replies", WithReplyErrorHandler(func(message *Message, err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}))
+	defer requester.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := requester.Request(ctx, &Message{Body: []byte("ping")}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Request returned %v, expected ErrUnauthorized.", err)
+	}
+	if _, err := requester.Request(ctx, &Message{Body: []byte("ping")}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Request after listening stopped returned %v, expected ErrUnauthorized.", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrUnauthorized) {
+		t.Errorf("Error handler was called with %v, expected ErrUnauthorized once.", errs)
+	}
+}
@@ -0,0 +1,312 @@
+package azureservicebus
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// SignatureProperty is the custom property holding the
+	// base64 encoded signature of a message
+	SignatureProperty = "Signature"
+	// SignatureKeyIDProperty is the custom property holding the id
+	// of the producer key a message was signed with
+	SignatureKeyIDProperty = "SignatureKeyId"
+	// SignedPropertiesProperty is the custom property listing the
+	// custom properties signed along with the body
+	SignedPropertiesProperty = "SignedProperties"
+	// SignedContentTypeProperty is the custom property telling whether
+	// the content type was signed, which it is when the sender set one
+	SignedContentTypeProperty = "SignedContentType"
+	// SignatureVerifiedProperty is set on received messages by a
+	// Verification in VerifyFlag mode, telling whether the signature
+	// was valid
+	SignatureVerifiedProperty = "SignatureVerified"
+)
+
+var (
+	// ErrMissingSignature is returned when a received message is not signed
+	ErrMissingSignature = errors.New("Message is not signed")
+	// ErrInvalidSignature is returned when the signature of a received
+	// message does not match, or its key is unknown
+	ErrInvalidSignature = errors.New("Message signature is invalid")
+)
+
+// Signer signs messages on behalf of a producer identified by KeyID
+type Signer interface {
+	KeyID() string
+	Sign(data []byte) ([]byte, error)
+}
+
+type hmacSigner struct {
+	keyID string
+	key   []byte
+}
+
+// NewHMACSigner creates a Signer using HMAC-SHA256 with a shared key
+func NewHMACSigner(keyID string, key []byte) Signer {
+	return &hmacSigner{keyID: keyID, key: key}
+}
+
+func (s *hmacSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *hmacSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+type ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a Signer using an ed25519 private key,
+// letting consumers verify messages without being able to sign them
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) Signer {
+	return &ed25519Signer{keyID: keyID, key: key}
+}
+
+func (s *ed25519Signer) KeyID() string {
+	return s.keyID
+}
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+// Keyring holds the keys of all producers whose messages a
+// consumer accepts. It is safe for concurrent use.
+type Keyring struct {
+	mu        sync.RWMutex
+	verifiers map[string]func(data []byte, signature []byte) bool
+}
+
+// NewKeyring creates an empty Keyring
+func NewKeyring() *Keyring {
+	return &Keyring{verifiers: make(map[string]func(data []byte, signature []byte) bool)}
+}
+
+// AddHMACKey adds the shared HMAC-SHA256 key of a producer
+func (k *Keyring) AddHMACKey(keyID string, key []byte) {
+	k.add(keyID, func(data []byte, signature []byte) bool {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hmac.Equal(mac.Sum(nil), signature)
+	})
+}
+
+// AddEd25519Key adds the ed25519 public key of a producer
+func (k *Keyring) AddEd25519Key(keyID string, key ed25519.PublicKey) {
+	k.add(keyID, func(data []byte, signature []byte) bool {
+		return ed25519.Verify(key, data, signature)
+	})
+}
+
+// Remove removes the key of a producer
+func (k *Keyring) Remove(keyID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.verifiers, keyID)
+}
+
+func (k *Keyring) add(keyID string, verify func(data []byte, signature []byte) bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.verifiers[keyID] = verify
+}
+
+// Verify checks a signature made with the key of a producer
+func (k *Keyring) Verify(keyID string, data []byte, signature []byte) error {
+	k.mu.RLock()
+	verify, ok := k.verifiers[keyID]
+	k.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, keyID)
+	}
+	if !verify(data, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// signedData serializes the key id, the broker properties set by the
+// sender, the signed custom properties and the body. TimeToLive and
+// ScheduledEnqueueTimeUtc are left out, as the broker fills them in,
+// and so is a content type the sender did not set.
+func signedData(message *Message, keyID string, signed string, signedContentType bool) ([]byte, error) {
+	contentType := "-"
+	if signedContentType {
+		contentType = "+" + message.ContentType
+	}
+
+	data := appendLengthPrefixed(nil, keyID)
+	for _, value := range []string{
+		message.MessageID,
+		message.CorrelationID,
+		message.SessionID,
+		message.ReplyToSessionID,
+		message.Label,
+		message.ReplyTo,
+		message.To,
+		message.PartitionKey,
+		contentType,
+	} {
+		data = appendLengthPrefixed(data, value)
+	}
+
+	data, err := appendProperties(data, message.Properties, signed)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, message.Body...), nil
+}
+
+// Signing is an Interceptor signing the body, the broker properties
+// and selected custom properties of outgoing messages
+type Signing struct {
+	signer     Signer
+	properties []string
+}
+
+// NewSigning creates a Signing which signs the named custom properties
+// along with the body and broker properties, or all custom properties
+// if none are named
+func NewSigning(signer Signer, properties ...string) *Signing {
+	return &Signing{signer: signer, properties: properties}
+}
+
+// WithSigning signs outgoing messages, see NewSigning
+func WithSigning(signer Signer, properties ...string) Option {
+	return WithInterceptor(NewSigning(signer, properties...))
+}
+
+// OutgoingMessage signs the message
+func (s *Signing) OutgoingMessage(ctx context.Context, message *Message) error {
+	signed := propertyNames(message.Properties)
+	if len(s.properties) > 0 {
+		var names []string
+		for _, name := range s.properties {
+			if _, ok := message.Properties.Get(name); ok {
+				names = append(names, strings.ToLower(name))
+			}
+		}
+		sort.Strings(names)
+		signed = strings.Join(names, ",")
+	}
+
+	signedContentType := message.ContentType != ""
+	data, err := signedData(message, s.signer.KeyID(), signed, signedContentType)
+	if err != nil {
+		return err
+	}
+
+	signature, err := s.signer.Sign(data)
+	if err != nil {
+		return err
+	}
+
+	if message.Properties == nil {
+		message.Properties = make(Properties)
+	}
+	message.Properties[SignatureKeyIDProperty] = s.signer.KeyID()
+	message.Properties[SignedPropertiesProperty] = signed
+	message.Properties[SignedContentTypeProperty] = signedContentType
+	message.Properties[SignatureProperty] = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// IncomingMessage leaves received messages untouched
+func (s *Signing) IncomingMessage(ctx context.Context, message *Message) error {
+	return nil
+}
+
+// VerificationMode decides what happens to received messages
+// with a missing or invalid signature
+type VerificationMode int
+
+const (
+	// VerifyReject fails the receive with ErrMissingSignature or
+	// ErrInvalidSignature
+	VerifyReject VerificationMode = iota
+	// VerifyFlag accepts the message, setting the SignatureVerified
+	// property to false
+	VerifyFlag
+)
+
+// Verification is an Interceptor verifying the signature of received
+// messages against the keys of a Keyring
+type Verification struct {
+	keyring *Keyring
+	mode    VerificationMode
+}
+
+// NewVerification creates a Verification
+func NewVerification(keyring *Keyring, mode VerificationMode) *Verification {
+	return &Verification{keyring: keyring, mode: mode}
+}
+
+// WithVerification verifies the signature of received messages
+func WithVerification(keyring *Keyring, mode VerificationMode) Option {
+	return WithInterceptor(NewVerification(keyring, mode))
+}
+
+// OutgoingMessage leaves sent messages untouched
+func (v *Verification) OutgoingMessage(ctx context.Context, message *Message) error {
+	return nil
+}
+
+// IncomingMessage verifies the signature of the message
+func (v *Verification) IncomingMessage(ctx context.Context, message *Message) error {
+	err := v.verify(message)
+
+	if v.mode == VerifyFlag {
+		if message.Properties == nil {
+			message.Properties = make(Properties)
+		}
+		for name := range message.Properties {
+			if strings.EqualFold(name, SignatureVerifiedProperty) {
+				delete(message.Properties, name)
+			}
+		}
+		message.Properties[SignatureVerifiedProperty] = err == nil
+		return nil
+	}
+
+	return err
+}
+
+func (v *Verification) verify(message *Message) error {
+	encoded, ok := message.Properties.String(SignatureProperty)
+	if !ok {
+		return ErrMissingSignature
+	}
+	keyID, _ := message.Properties.String(SignatureKeyIDProperty)
+	signed, _ := message.Properties.String(SignedPropertiesProperty)
+	signedContentType, _ := message.Properties.Bool(SignedContentTypeProperty)
+
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	data, err := signedData(message, keyID, signed, signedContentType)
+	if err != nil {
+		return fmt.Errorf("%w: signed %v", ErrInvalidSignature, err)
+	}
+
+	return v.keyring.Verify(keyID, data, signature)
+}
@@ -0,0 +1,94 @@
+package azureservicebus
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestSigningHMAC(t *testing.T) {
+	keyring := NewKeyring()
+	keyring.AddHMACKey("orders", []byte("orders-secret"))
+	keyring.AddHMACKey("billing", []byte("billing-secret"))
+
+	client, queue, ts := newTestQueueClient(t,
+		WithSigning(NewHMACSigner("orders", []byte("orders-secret")), "Amount"),
+		WithVerification(keyring, VerifyReject))
+	defer ts.Close()
+
+	client.Send(&Message{Body: []byte("test-body"), Properties: Properties{"Amount": int64(10), "Note": "unsigned"}})
+	client.Send(&Message{Body: []byte("test-body"), Properties: Properties{"Amount": int64(10)}})
+	queue.messages[1].header.Set("Amount", "1000")
+	queue.messages = append(queue.messages, testQueueMessage{header: make(map[string][]string), body: []byte("test-body")})
+
+	if _, err := client.PeekLockMessage(1); err != nil {
+		t.Errorf("Signed message did not verify: %v", err)
+	}
+	if _, err := client.PeekLockMessage(1); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Tampered signed property did not fail verification.")
+	}
+	if _, err := client.PeekLockMessage(1); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("Unsigned message did not fail verification.")
+	}
+}
+
+func TestSigningEd25519Flag(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Could not generate ed25519 key.")
+	}
+
+	keyring := NewKeyring()
+	keyring.AddEd25519Key("orders", public)
+
+	client, queue, ts := newTestQueueClient(t,
+		WithSigning(NewEd25519Signer("orders", private)),
+		WithVerification(keyring, VerifyFlag))
+	defer ts.Close()
+
+	client.Send(&Message{Body: []byte("test-body")})
+	client.Send(&Message{Body: []byte("test-body")})
+	queue.messages[1].body = []byte("tampered")
+
+	msg, err := client.PeekLockMessage(1)
+	if err != nil {
+		t.Fatalf("Flagging verification returned an error: %v", err)
+	}
+	if verified, _ := msg.Properties.Bool(SignatureVerifiedProperty); !verified {
+		t.Errorf("Signed message was not flagged as verified.")
+	}
+
+	msg, err = client.PeekLockMessage(1)
+	if err != nil {
+		t.Fatalf("Flagging verification returned an error: %v", err)
+	}
+	if verified, ok := msg.Properties.Bool(SignatureVerifiedProperty); !ok || verified {
+		t.Errorf("Tampered message was not flagged as unverified.")
+	}
+}
+
+func TestSigningBrokerProperties(t *testing.T) {
+	keyring := NewKeyring()
+	keyring.AddHMACKey("orders", []byte("orders-secret"))
+
+	client, queue, ts := newTestQueueClient(t,
+		WithSigning(NewHMACSigner("orders", []byte("orders-secret"))),
+		WithVerification(keyring, VerifyReject))
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		client.Send(&Message{MessageID: "id", ReplyTo: "replies", ContentType: "text/plain", Body: []byte("test-body")})
+	}
+	queue.messages[1].header.Set("BrokerProperties", `{"MessageId":"id","ReplyTo":"attacker"}`)
+	queue.messages[2].header.Set("Content-Type", "application/json")
+
+	if _, err := client.PeekLockMessage(1); err != nil {
+		t.Errorf("Signed message did not verify: %v", err)
+	}
+	if _, err := client.PeekLockMessage(1); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Tampered ReplyTo did not fail verification.")
+	}
+	if _, err := client.PeekLockMessage(1); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Tampered content type did not fail verification.")
+	}
+}